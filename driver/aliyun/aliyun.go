@@ -10,6 +10,8 @@ import (
 	"github/vlorc/loki-grpc-storage/types"
 	"github/vlorc/loki-grpc-storage/utils"
 	"go.uber.org/zap"
+	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -20,7 +22,11 @@ type Aliyun struct {
 	option []oss.Option
 }
 
+var encoder = utils.ObjectEncoder
+
 var _ types.ObjectClient = &Aliyun{}
+var _ types.ObjectLister = &Aliyun{}
+var _ types.ObjectStater = &Aliyun{}
 
 func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 	qn, err := Factory(log, config)
@@ -79,21 +85,38 @@ func Factory(log *zap.Logger, config *types.StoreConfig) (types.ObjectClient, er
 }
 
 func (bd *Aliyun) PutObject(ctx context.Context, key string, object []byte) error {
-	return bd.write(ctx, key, object)
+	return classify(key, bd.write(ctx, encoder.Encode(key), object))
 }
 
 func (al *Aliyun) GetObject(ctx context.Context, key string) ([]byte, error) {
-	return al.read(ctx, key)
+	buf, err := al.read(ctx, encoder.Encode(key))
+	return buf, classify(key, err)
 }
 
 func (al *Aliyun) DeleteObject(ctx context.Context, key string) error {
-	return al.remove(ctx, key)
+	return classify(key, al.remove(ctx, encoder.Encode(key)))
 }
 
 func (al *Aliyun) Ping() error {
 	return nil
 }
 
+func (al *Aliyun) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	info, err := al.stat(ctx, encoder.Encode(key))
+	if nil != info {
+		info.Key = key
+	}
+	return info, classify(key, err)
+}
+
+func (al *Aliyun) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	objects, next, err := al.list(ctx, encoder.Encode(prefix), encoder.Encode(after), limit)
+	for i := range objects {
+		objects[i].Key = utils.DecodeKey(encoder, objects[i].Key)
+	}
+	return objects, utils.DecodeKey(encoder, next), classify(prefix, err)
+}
+
 func (al *Aliyun) remove(ctx context.Context, key string) error {
 	err := al.bucket.DeleteObject(key)
 
@@ -115,3 +138,60 @@ func (al *Aliyun) read(ctx context.Context, key string) ([]byte, error) {
 
 	return utils.ReadAll(body)
 }
+
+func (al *Aliyun) stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	header, err := al.bucket.GetObjectMeta(key)
+	if nil != err {
+		return nil, err
+	}
+
+	size, _ := strconv.ParseInt(header.Get(oss.HTTPHeaderContentLength), 10, 64)
+	modified, _ := http.ParseTime(header.Get(oss.HTTPHeaderLastModified))
+
+	return &types.ObjectInfo{
+		Key:      key,
+		Size:     size,
+		Modified: modified,
+		Checksum: strings.Trim(header.Get(oss.HTTPHeaderEtag), `"`),
+	}, nil
+}
+
+func (al *Aliyun) list(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	result, err := al.bucket.ListObjectsV2(oss.Prefix(prefix), oss.StartAfter(after), oss.MaxKeys(limit))
+	if nil != err {
+		return nil, "", err
+	}
+
+	objects := make([]types.ObjectInfo, len(result.Objects))
+	for i, o := range result.Objects {
+		objects[i] = types.ObjectInfo{Key: o.Key, Size: o.Size, Modified: o.LastModified}
+	}
+	if result.IsTruncated && len(objects) > 0 {
+		return objects, objects[len(objects)-1].Key, nil
+	}
+
+	return objects, "", nil
+}
+
+func classify(key string, err error) error {
+	e, ok := err.(oss.ServiceError)
+	if !ok {
+		return types.NewError(types.KindOfError(err), key, err)
+	}
+
+	switch e.Code {
+	case "NoSuchKey":
+		return types.NewError(types.KindNotFound, key, err)
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return types.NewError(types.KindPermissionDenied, key, err)
+	case "InvalidObjectName", "KeyTooLong":
+		return types.NewError(types.KindInvalidKey, key, err)
+	case "SlowDown", "DownloadTrafficRateLimitExceeded", "UploadTrafficRateLimitExceeded":
+		return types.NewError(types.KindThrottled, key, err)
+	}
+	return types.NewError(types.KindOfStatus(e.StatusCode), key, err)
+}
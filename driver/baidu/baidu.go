@@ -5,10 +5,14 @@ package baidu
 
 import (
 	"context"
+	"github.com/baidubce/bce-sdk-go/bce"
 	"github.com/baidubce/bce-sdk-go/services/bos"
+	"github.com/baidubce/bce-sdk-go/services/bos/api"
+	"github.com/baidubce/bce-sdk-go/util"
 	"github/vlorc/loki-grpc-storage/types"
 	"github/vlorc/loki-grpc-storage/utils"
 	"go.uber.org/zap"
+	"strings"
 )
 
 type Baidu struct {
@@ -18,7 +22,11 @@ type Baidu struct {
 	domain string
 }
 
+var encoder = utils.ObjectEncoder
+
 var _ types.ObjectClient = &Baidu{}
+var _ types.ObjectLister = &Baidu{}
+var _ types.ObjectStater = &Baidu{}
 
 func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 	qn, err := Factory(log, config)
@@ -49,21 +57,38 @@ func Factory(log *zap.Logger, config *types.StoreConfig) (types.ObjectClient, er
 }
 
 func (bd *Baidu) PutObject(ctx context.Context, key string, object []byte) error {
-	return bd.write(ctx, key, object)
+	return classify(key, bd.write(ctx, encoder.Encode(key), object))
 }
 
 func (bd *Baidu) GetObject(ctx context.Context, key string) ([]byte, error) {
-	return bd.read(ctx, key)
+	buf, err := bd.read(ctx, encoder.Encode(key))
+	return buf, classify(key, err)
 }
 
 func (bd *Baidu) DeleteObject(ctx context.Context, key string) error {
-	return bd.remove(ctx, key)
+	return classify(key, bd.remove(ctx, encoder.Encode(key)))
 }
 
 func (bd *Baidu) Ping() error {
 	return nil
 }
 
+func (bd *Baidu) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	info, err := bd.stat(ctx, encoder.Encode(key))
+	if nil != info {
+		info.Key = key
+	}
+	return info, classify(key, err)
+}
+
+func (bd *Baidu) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	objects, next, err := bd.list(ctx, encoder.Encode(prefix), encoder.Encode(after), limit)
+	for i := range objects {
+		objects[i].Key = utils.DecodeKey(encoder, objects[i].Key)
+	}
+	return objects, utils.DecodeKey(encoder, next), classify(prefix, err)
+}
+
 func (bd *Baidu) remove(ctx context.Context, key string) error {
 	err := bd.client.DeleteObject(bd.bucket, key)
 
@@ -85,3 +110,64 @@ func (bd *Baidu) read(ctx context.Context, key string) ([]byte, error) {
 
 	return utils.ReadAll(resp.Body)
 }
+
+func (bd *Baidu) stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	meta, err := bd.client.GetObjectMeta(bd.bucket, key)
+	if nil != err {
+		return nil, err
+	}
+
+	modified, _ := util.ParseRFC822Date(meta.LastModified)
+
+	return &types.ObjectInfo{
+		Key:      key,
+		Size:     meta.ContentLength,
+		Modified: modified,
+		Checksum: strings.Trim(meta.ETag, `"`),
+	}, nil
+}
+
+func (bd *Baidu) list(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	result, err := bd.client.ListObjects(bd.bucket, &api.ListObjectsArgs{Prefix: prefix, Marker: after, MaxKeys: limit})
+	if nil != err {
+		return nil, "", err
+	}
+
+	objects := make([]types.ObjectInfo, len(result.Contents))
+	for i, o := range result.Contents {
+		modified, _ := util.ParseISO8601Date(o.LastModified)
+		objects[i] = types.ObjectInfo{Key: o.Key, Size: int64(o.Size), Modified: modified}
+	}
+	if result.IsTruncated && len(objects) > 0 {
+		return objects, objects[len(objects)-1].Key, nil
+	}
+
+	return objects, "", nil
+}
+
+func classify(key string, err error) error {
+	switch e := err.(type) {
+	case *bce.BceServiceError:
+		switch e.Code {
+		case "NoSuchKey":
+			return types.NewError(types.KindNotFound, key, err)
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+			return types.NewError(types.KindPermissionDenied, key, err)
+		case "InvalidObjectName":
+			return types.NewError(types.KindInvalidKey, key, err)
+		case "RequestRateLimitExceeded", "SlowDown":
+			return types.NewError(types.KindThrottled, key, err)
+		}
+		return types.NewError(types.KindOfStatus(e.StatusCode), key, err)
+	case *bce.BceClientError:
+		// the client of bos reports transport failures only by message after its retries
+		if strings.HasPrefix(e.Message, "execute http request failed") {
+			return types.NewError(types.KindUnavailable, key, err)
+		}
+	}
+	return types.NewError(types.KindOfError(err), key, err)
+}
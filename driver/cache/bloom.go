@@ -0,0 +1,52 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import "hash/fnv"
+
+// about 1% of false positives with 7 hashes and 9.6 bits per key
+const (
+	bloomBits   = 9.6
+	bloomHashes = 7
+)
+
+// bloom tells keys which were never added, keys which may have been added are not answered.
+type bloom struct {
+	bits []uint64
+	size uint64
+}
+
+func newBloom(expected int) *bloom {
+	words := (uint64(float64(expected)*bloomBits) + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &bloom{bits: make([]uint64, words), size: words * 64}
+}
+
+func (b *bloom) add(key string) {
+	h1, h2 := hash(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		n := (h1 + i*h2) % b.size
+		b.bits[n/64] |= 1 << (n % 64)
+	}
+}
+
+func (b *bloom) test(key string) bool {
+	h1, h2 := hash(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		n := (h1 + i*h2) % b.size
+		if 0 == b.bits[n/64]&(1<<(n%64)) {
+			return false
+		}
+	}
+	return true
+}
+
+func hash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
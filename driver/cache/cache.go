@@ -0,0 +1,104 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import (
+	"context"
+	"expvar"
+	"github/vlorc/loki-grpc-storage/types"
+	"sync/atomic"
+	"time"
+)
+
+var caches = expvar.NewMap("store_cache")
+
+// Stats are the counters of a cache, published in expvar under store_cache by store name.
+type Stats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Evicted  int64 `json:"evicted"`
+	Objects  int   `json:"objects"`
+	Bytes    int64 `json:"bytes"`
+	Corrupt  int64 `json:"corrupt,omitempty"`
+	Filtered int64 `json:"filtered,omitempty"`
+}
+
+// Cache keeps the objects read or written through it in a byte bounded lru,
+// puts write through and deletes invalidate, so a single writer always reads its own writes.
+type Cache struct {
+	hits   int64
+	misses int64
+	store  types.ObjectClient
+	lru    *lru
+}
+
+func New(store types.ObjectClient, capacity int64, ttl time.Duration) *Cache {
+	return &Cache{store: store, lru: newLRU(capacity, ttl)}
+}
+
+// Wrap caches up to capacity bytes of the objects of the store, for ttl when it is positive.
+func Wrap(store types.ObjectClient, name string, capacity int64, ttl time.Duration) types.ObjectClient {
+	c := New(store, capacity, ttl)
+	caches.Set(name, expvar.Func(func() interface{} {
+		return c.Stats()
+	}))
+	return types.Decorate(c, store)
+}
+
+func (c *Cache) PutObject(ctx context.Context, key string, object []byte) error {
+	if err := c.store.PutObject(ctx, key, object); nil != err {
+		c.lru.delete(key)
+		return err
+	}
+	c.lru.put(key, object, time.Now())
+	return nil
+}
+
+func (c *Cache) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if buf, ok := c.lru.get(key, time.Now()); ok {
+		atomic.AddInt64(&c.hits, 1)
+		return buf, nil
+	}
+	atomic.AddInt64(&c.misses, 1)
+
+	version := c.lru.begin(key)
+	defer c.lru.end(key)
+	buf, err := c.store.GetObject(ctx, key)
+	if nil != err {
+		return buf, err
+	}
+	c.lru.fill(key, buf, int64(len(buf)), version, time.Now())
+
+	return buf, nil
+}
+
+func (c *Cache) DeleteObject(ctx context.Context, key string) error {
+	c.lru.delete(key)
+	err := c.store.DeleteObject(ctx, key)
+	c.lru.delete(key)
+	return err
+}
+
+func (c *Cache) Ping() error {
+	return c.store.Ping()
+}
+
+func (c *Cache) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return c.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+func (c *Cache) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	return c.store.(types.ObjectStater).Stat(ctx, key)
+}
+
+func (c *Cache) Stats() Stats {
+	objects, bytes, evicted := c.lru.stats()
+	return Stats{
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+		Evicted: evicted,
+		Objects: objects,
+		Bytes:   bytes,
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestCache_Object(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	c := New(store, 8, 0)
+
+	store.PutObject(context.Background(), "a", []byte("aaaa"))
+	for i := 0; i < 2; i++ {
+		if buf, err := c.GetObject(context.Background(), "a"); nil != err || string(buf) != "aaaa" {
+			t.Error("getObject failed", err)
+		}
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 1 || s.Bytes != 4 {
+		t.Error("stats failed", s)
+	}
+
+	c.PutObject(context.Background(), "b", []byte("bbbb"))
+	c.PutObject(context.Background(), "c", []byte("cccc"))
+	if s := c.Stats(); s.Objects != 2 || s.Evicted != 1 || s.Bytes != 8 {
+		t.Error("evict failed", s)
+	}
+	if _, ok := c.lru.get("a", time.Now()); ok {
+		t.Error("least recently used not evicted")
+	}
+
+	store.PutObject(context.Background(), "b", []byte("stale"))
+	if buf, _ := c.GetObject(context.Background(), "b"); !bytes.Equal(buf, []byte("bbbb")) {
+		t.Error("write through failed", string(buf))
+	}
+	if err := c.DeleteObject(context.Background(), "b"); nil != err {
+		t.Error("deleteObject failed", err.Error())
+	}
+	if _, err := c.GetObject(context.Background(), "b"); !types.IsNotFound(err) {
+		t.Error("delete not invalidated", err)
+	}
+
+	c.PutObject(context.Background(), "large", []byte("0123456789"))
+	if _, ok := c.lru.get("large", time.Now()); ok {
+		t.Error("large object cached")
+	}
+}
+
+func TestCache_Expire(t *testing.T) {
+	c := newLRU(1024, time.Minute)
+	now := time.Now()
+
+	c.put("a", []byte("a"), now)
+	if _, ok := c.get("a", now.Add(time.Second)); !ok {
+		t.Error("get failed")
+	}
+	if _, ok := c.get("a", now.Add(2*time.Minute)); ok {
+		t.Error("expired entry returned")
+	}
+
+	version := c.begin("b")
+	c.delete("b")
+	c.fill("b", []byte("stale"), 5, version, now)
+	c.end("b")
+	if _, ok := c.get("b", now); ok {
+		t.Error("stale fill kept")
+	}
+
+	version = c.begin("c")
+	c.put("d", []byte("d"), now)
+	c.delete("e")
+	c.fill("c", []byte("c"), 1, version, now)
+	c.end("c")
+	if _, ok := c.get("c", now); !ok {
+		t.Error("fill dropped by other keys")
+	}
+	if 0 != len(c.reads) {
+		t.Error("reads not ended", len(c.reads))
+	}
+}
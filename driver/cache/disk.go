@@ -0,0 +1,341 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"expvar"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/driver/filesystem"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// a cache file is the magic and the crc32 of the object followed by the object
+var magic = []byte("\x89LGD")
+
+const headerSize = 8
+
+// fills are written below this directory and renamed in place once complete
+const fillDir = ".fill"
+
+// the access time of a file, which orders the lru at startup, is updated at most once per interval
+const touchInterval = time.Minute
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorrupt = errors.New("corrupt cache file")
+
+// Disk keeps the objects read or written through it in files below a directory, laid out as the
+// filesystem driver does, and evicts the least recently accessed ones over the capacity.
+// The files are found again at startup, and those failing their checksum are fetched again.
+type Disk struct {
+	hits    int64
+	misses  int64
+	corrupt int64
+	store   types.ObjectClient
+	log     *zap.Logger
+	root    string
+	lock    sync.Mutex
+	lru     *lru
+	evicted []string
+}
+
+func NewDisk(log *zap.Logger, store types.ObjectClient, dir string, capacity int64) (*Disk, error) {
+	root, err := filepath.Abs(filepath.Clean(dir))
+	if nil != err {
+		return nil, err
+	}
+	d := &Disk{store: store, log: log.With(zap.String("cache", root)), root: root, lru: newLRU(capacity, 0)}
+	d.lru.evict = d.evict
+
+	if err := os.RemoveAll(filepath.Join(root, fillDir)); nil != err {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, fillDir), 0755); nil != err {
+		return nil, err
+	}
+
+	return d, d.scan()
+}
+
+// WrapDisk caches up to capacity bytes of the objects of the store below dir.
+func WrapDisk(log *zap.Logger, store types.ObjectClient, name, dir string, capacity int64) (types.ObjectClient, error) {
+	d, err := NewDisk(log, store, dir, capacity)
+	if nil != err {
+		return nil, err
+	}
+	caches.Set(name+"/disk", expvar.Func(func() interface{} {
+		return d.Stats()
+	}))
+	return types.Decorate(d, store), nil
+}
+
+func (d *Disk) PutObject(ctx context.Context, key string, object []byte) error {
+	if err := d.store.PutObject(ctx, key, object); nil != err {
+		d.invalidate(key)
+		return err
+	}
+	d.fill(key, object, 0, true)
+	return nil
+}
+
+func (d *Disk) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if buf, ok := d.read(key); ok {
+		atomic.AddInt64(&d.hits, 1)
+		return buf, nil
+	}
+	atomic.AddInt64(&d.misses, 1)
+
+	version := d.lru.begin(key)
+	defer d.lru.end(key)
+	buf, err := d.store.GetObject(ctx, key)
+	if nil != err {
+		return buf, err
+	}
+	d.fill(key, buf, version, false)
+
+	return buf, nil
+}
+
+func (d *Disk) DeleteObject(ctx context.Context, key string) error {
+	d.invalidate(key)
+	err := d.store.DeleteObject(ctx, key)
+	d.invalidate(key)
+	return err
+}
+
+func (d *Disk) Ping() error {
+	return d.store.Ping()
+}
+
+func (d *Disk) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return d.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+func (d *Disk) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	return d.store.(types.ObjectStater).Stat(ctx, key)
+}
+
+func (d *Disk) Stats() Stats {
+	objects, bytes, evicted := d.lru.stats()
+	return Stats{
+		Hits:    atomic.LoadInt64(&d.hits),
+		Misses:  atomic.LoadInt64(&d.misses),
+		Evicted: evicted,
+		Objects: objects,
+		Bytes:   bytes,
+		Corrupt: atomic.LoadInt64(&d.corrupt),
+	}
+}
+
+// read returns the cached object and marks it accessed, corrupt files are dropped
+// unless the key was filled again meanwhile.
+func (d *Disk) read(key string) ([]byte, bool) {
+	version := d.lru.begin(key)
+	defer d.lru.end(key)
+
+	if _, ok := d.lru.get(key, time.Now()); !ok {
+		return nil, false
+	}
+	p, err := filesystem.Path(d.root, key)
+	if nil != err {
+		return nil, false
+	}
+
+	buf, modified, err := load(p)
+	if nil != err {
+		if !os.IsNotExist(err) {
+			atomic.AddInt64(&d.corrupt, 1)
+			d.log.Warn("cache file", zap.String("key", key), zap.String("path", p), zap.Error(err))
+		}
+		d.lock.Lock()
+		if !d.lru.changed(key, version) {
+			d.lru.delete(key)
+			d.evict(key)
+		}
+		d.unlock()
+		return nil, false
+	}
+
+	if now := time.Now(); now.Sub(modified) >= touchInterval {
+		_ = os.Chtimes(p, now, now)
+	}
+	return buf, true
+}
+
+// load reads and checks a cache file, and returns when it was last accessed.
+func load(p string) ([]byte, time.Time, error) {
+	f, err := os.Open(p)
+	if nil != err {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if nil != err {
+		return nil, time.Time{}, err
+	}
+	buf, err := ioutil.ReadAll(f)
+	if nil == err {
+		buf, err = decode(buf)
+	}
+	return buf, info.ModTime(), err
+}
+
+// fill writes the object to a temporary file and renames it in place, a read is kept only
+// when the key was not put or deleted since version was taken so it never replaces a newer write.
+func (d *Disk) fill(key string, object []byte, version uint64, write bool) {
+	p, err := filesystem.Path(d.root, key)
+	if nil != err {
+		return
+	}
+	size := int64(headerSize + len(object))
+	if size > d.lru.capacity {
+		return
+	}
+
+	tmp, err := d.temp(object)
+	if nil != err {
+		d.log.Warn("fill cache", zap.String("key", key), zap.Error(err))
+		return
+	}
+
+	d.lock.Lock()
+	defer d.unlock()
+
+	if !write && d.lru.changed(key, version) {
+		os.Remove(tmp)
+		return
+	}
+	if err = os.Rename(tmp, p); nil != err && os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(p), 0755); nil == err {
+			err = os.Rename(tmp, p)
+		}
+	}
+	if nil != err {
+		os.Remove(tmp)
+		d.log.Warn("fill cache", zap.String("key", key), zap.String("path", p), zap.Error(err))
+		return
+	}
+	d.lru.keep(key, size, time.Now())
+}
+
+func (d *Disk) temp(object []byte) (string, error) {
+	f, err := ioutil.TempFile(filepath.Join(d.root, fillDir), "fill-")
+	if nil != err {
+		return "", err
+	}
+	_, err = f.Write(encode(object))
+	if e := f.Close(); nil == err {
+		err = e
+	}
+	if nil != err {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func (d *Disk) invalidate(key string) {
+	d.lock.Lock()
+	defer d.unlock()
+
+	d.lru.delete(key)
+	d.evict(key)
+}
+
+// evict queues the file of the key for removal, it is called with the lock held.
+func (d *Disk) evict(key string) {
+	if p, err := filesystem.Path(d.root, key); nil == err {
+		d.evicted = append(d.evicted, p)
+	}
+}
+
+// unlock releases the lock and then removes the evicted files, a fill of the key landing in
+// between loses its file, which the next read finds missing and drops.
+func (d *Disk) unlock() {
+	evicted := d.evicted
+	d.evicted = nil
+	d.lock.Unlock()
+
+	for _, p := range evicted {
+		if err := os.Remove(p); nil != err && !os.IsNotExist(err) {
+			d.log.Warn("evict cache", zap.String("path", p), zap.Error(err))
+		}
+	}
+}
+
+// scan rebuilds the lru from the files of the directory, the least recently accessed first.
+func (d *Disk) scan() error {
+	type file struct {
+		key      string
+		size     int64
+		modified time.Time
+	}
+
+	var files []file
+	err := filepath.Walk(d.root, func(p string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() {
+			if fillDir == info.Name() && filepath.Dir(p) == d.root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		key, err := filesystem.Key(d.root, p)
+		if nil != err {
+			return err
+		}
+		files = append(files, file{key: key, size: info.Size(), modified: info.ModTime()})
+		return nil
+	})
+	if nil != err {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modified.Before(files[j].modified)
+	})
+	var size int64
+	d.lock.Lock()
+	for _, f := range files {
+		d.lru.keep(f.key, f.size, f.modified)
+		size += f.size
+	}
+	d.unlock()
+	d.log.Info("scan cache", zap.Int("objects", len(files)), zap.Int64("bytes", size))
+
+	return nil
+}
+
+func encode(object []byte) []byte {
+	buf := make([]byte, headerSize+len(object))
+	copy(buf, magic)
+	binary.BigEndian.PutUint32(buf[len(magic):], crc32.Checksum(object, castagnoli))
+	copy(buf[headerSize:], object)
+	return buf
+}
+
+func decode(buf []byte) ([]byte, error) {
+	if len(buf) < headerSize || !bytes.HasPrefix(buf, magic) {
+		return nil, errCorrupt
+	}
+	if binary.BigEndian.Uint32(buf[len(magic):]) != crc32.Checksum(buf[headerSize:], castagnoli) {
+		return nil, errCorrupt
+	}
+	return buf[headerSize:], nil
+}
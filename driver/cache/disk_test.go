@@ -0,0 +1,96 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/driver/filesystem"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDisk_Object(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	d, err := NewDisk(log, store, dir, 3*(headerSize+4))
+	if nil != err {
+		t.Fatal("newDisk failed", err.Error())
+	}
+
+	keys := []string{"fake/a", "fake/b:c", "fake/d"}
+	for _, key := range keys {
+		store.PutObject(context.Background(), key, []byte((key[5:] + "xxx")[:4]))
+		if _, err := d.GetObject(context.Background(), key); nil != err {
+			t.Error("getObject failed", key, err.Error())
+		}
+	}
+	if buf, err := d.GetObject(context.Background(), "fake/a"); nil != err || string(buf) != "axxx" {
+		t.Error("getObject failed", string(buf), err)
+	}
+	if s := d.Stats(); s.Hits != 1 || s.Misses != 3 || s.Objects != 3 {
+		t.Error("stats failed", s)
+	}
+
+	// "fake/b:c" is the least recently accessed
+	if err := d.PutObject(context.Background(), "fake/e", []byte("eeee")); nil != err {
+		t.Error("putObject failed", err.Error())
+	}
+	if p, _ := filesystem.Path(d.root, "fake/b:c"); nil == __stat(p) {
+		t.Error("least recently used not evicted")
+	}
+
+	p, _ := filesystem.Path(d.root, "fake/d")
+	ioutil.WriteFile(p, encode([]byte("dddd"))[:headerSize+2], 0644)
+	store.PutObject(context.Background(), "fake/d", []byte("dddd"))
+	if buf, err := d.GetObject(context.Background(), "fake/d"); nil != err || string(buf) != "dddd" {
+		t.Error("corrupt file served", string(buf), err)
+	}
+	if s := d.Stats(); s.Corrupt != 1 {
+		t.Error("corrupt not counted", s)
+	}
+
+	// the access time is updated once per interval
+	p, _ = filesystem.Path(d.root, "fake/a")
+	old := time.Now().Add(-2 * touchInterval)
+	os.Chtimes(p, old, old)
+	d.GetObject(context.Background(), "fake/a")
+	if info, err := os.Stat(p); nil != err || !info.ModTime().After(old.Add(touchInterval)) {
+		t.Error("access time not updated", err)
+	}
+	recent := time.Now().Add(-touchInterval / 2).Truncate(time.Second)
+	os.Chtimes(p, recent, recent)
+	d.GetObject(context.Background(), "fake/a")
+	if info, err := os.Stat(p); nil != err || !info.ModTime().Equal(recent) {
+		t.Error("access time updated too often", err)
+	}
+
+	reload, err := NewDisk(log, store, dir, 3*(headerSize+4))
+	if nil != err {
+		t.Fatal("newDisk failed", err.Error())
+	}
+	for _, key := range []string{"fake/a", "fake/d", "fake/e"} {
+		if _, ok := reload.lru.get(key, time.Now()); !ok {
+			t.Error("scan failed", key)
+		}
+	}
+	if s := reload.Stats(); s.Objects != 3 || s.Bytes != 3*(headerSize+4) {
+		t.Error("scan failed", s)
+	}
+}
+
+func __stat(p string) error {
+	_, err := os.Stat(p)
+	return err
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key    string
+	value  []byte
+	size   int64
+	expire time.Time
+}
+
+// read is a key being read from the store, its version counts the puts and deletes made meanwhile.
+type read struct {
+	version uint64
+	readers int
+}
+
+// lru keeps the most recently used objects up to a number of bytes,
+// entries older than the ttl are dropped when they are read and evict is told the keys pushed out.
+type lru struct {
+	lock     sync.Mutex
+	capacity int64
+	ttl      time.Duration
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+	reads    map[string]*read
+	evicted  int64
+	evict    func(key string)
+}
+
+func newLRU(capacity int64, ttl time.Duration) *lru {
+	return &lru{capacity: capacity, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}, reads: map[string]*read{}}
+}
+
+func (c *lru) get(key string, now time.Time) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if v := e.Value.(*entry); !v.expire.IsZero() && now.After(v.expire) {
+		c.remove(e)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+
+	return e.Value.(*entry).value, true
+}
+
+// put stores the value and evicts the least recently used entries over the capacity,
+// values larger than the whole cache are not kept.
+func (c *lru) put(key string, value []byte, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.touch(key)
+	c.add(key, value, int64(len(value)), now)
+}
+
+// keep records an entry of size bytes without keeping its value, for values stored elsewhere.
+func (c *lru) keep(key string, size int64, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.touch(key)
+	c.add(key, nil, size, now)
+}
+
+// fill stores a value read from the store unless the key was put or deleted since begin,
+// a slow read never replaces a newer write.
+func (c *lru) fill(key string, value []byte, size int64, version uint64, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.unchanged(key, version) {
+		c.add(key, value, size, now)
+	}
+}
+
+func (c *lru) delete(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.touch(key)
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+}
+
+// begin starts a read of the key from the store and returns its version, every begin is followed by an end.
+func (c *lru) begin(key string) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r, ok := c.reads[key]
+	if !ok {
+		r = &read{}
+		c.reads[key] = r
+	}
+	r.readers++
+	return r.version
+}
+
+func (c *lru) end(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if r, ok := c.reads[key]; ok {
+		if r.readers--; 0 == r.readers {
+			delete(c.reads, key)
+		}
+	}
+}
+
+// changed tells whether the key was put or deleted since begin returned version.
+func (c *lru) changed(key string, version uint64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return !c.unchanged(key, version)
+}
+
+func (c *lru) stats() (objects int, bytes, evicted int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.entries), c.size, c.evicted
+}
+
+func (c *lru) touch(key string) {
+	if r, ok := c.reads[key]; ok {
+		r.version++
+	}
+}
+
+func (c *lru) unchanged(key string, version uint64) bool {
+	r, ok := c.reads[key]
+	return ok && r.version == version
+}
+
+func (c *lru) add(key string, value []byte, size int64, now time.Time) {
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	if size > c.capacity {
+		if nil != c.evict {
+			c.evict(key)
+		}
+		return
+	}
+
+	v := &entry{key: key, value: value, size: size}
+	if c.ttl > 0 {
+		v.expire = now.Add(c.ttl)
+	}
+	c.entries[key] = c.order.PushFront(v)
+	c.size += size
+
+	for c.size > c.capacity {
+		v := c.remove(c.order.Back())
+		c.evicted++
+		if nil != c.evict {
+			c.evict(v.key)
+		}
+	}
+}
+
+func (c *lru) remove(e *list.Element) *entry {
+	v := c.order.Remove(e).(*entry)
+	delete(c.entries, v.key)
+	c.size -= v.size
+	return v
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import (
+	"context"
+	"expvar"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the most missing keys remembered
+const negativeSize = 65536
+
+const pageSize = 1000
+
+// Negative answers the reads of keys known to be missing without asking the store, keys found
+// missing are remembered for the ttl and, once built from a listing, keys which are not in the
+// bloom filter were never written. Both only see the puts made through them, so they are only
+// safe with a single writer, other writers to the same store are missed for the ttl, or until
+// the filter is built again.
+type Negative struct {
+	hits     int64
+	misses   int64
+	filtered int64
+	store    types.ObjectClient
+	log      *zap.Logger
+	ttl      time.Duration
+	expected int
+	lru      *lru
+	lock     sync.RWMutex
+	bloom    *bloom
+	building *bloom
+}
+
+func NewNegative(log *zap.Logger, store types.ObjectClient, ttl time.Duration, expected int) *Negative {
+	return &Negative{store: store, log: log, ttl: ttl, expected: expected, lru: newLRU(negativeSize, ttl)}
+}
+
+// WrapNegative remembers the missing keys of the store for ttl, and builds the bloom filter
+// of expected keys in the background every interval when expected is positive.
+func WrapNegative(log *zap.Logger, store types.ObjectClient, name string, ttl time.Duration, expected int, interval time.Duration) types.ObjectClient {
+	n := NewNegative(log, store, ttl, expected)
+	caches.Set(name+"/negative", expvar.Func(func() interface{} {
+		return n.Stats()
+	}))
+	if expected > 0 {
+		go n.Run(context.Background(), interval)
+	}
+	return types.Decorate(n, store)
+}
+
+// Run builds the bloom filter and builds it again every interval until the context is done,
+// it is built once when the interval is not positive.
+func (n *Negative) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := n.Scan(ctx); nil != err && nil == ctx.Err() {
+			n.log.Warn("bloom filter disabled", zap.Error(err))
+		}
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *Negative) PutObject(ctx context.Context, key string, object []byte) error {
+	n.lock.Lock()
+	for _, b := range []*bloom{n.bloom, n.building} {
+		if nil != b {
+			b.add(key)
+		}
+	}
+	n.lock.Unlock()
+
+	n.lru.delete(key)
+	err := n.store.PutObject(ctx, key, object)
+	n.lru.delete(key)
+	return err
+}
+
+func (n *Negative) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if n.missing(key) {
+		return nil, types.NotFound(key)
+	}
+
+	version := n.lru.begin(key)
+	defer n.lru.end(key)
+	buf, err := n.store.GetObject(ctx, key)
+	n.remember(key, err, version)
+	return buf, err
+}
+
+func (n *Negative) DeleteObject(ctx context.Context, key string) error {
+	return n.store.DeleteObject(ctx, key)
+}
+
+func (n *Negative) Ping() error {
+	return n.store.Ping()
+}
+
+func (n *Negative) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return n.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+func (n *Negative) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	if n.missing(key) {
+		return nil, types.NotFound(key)
+	}
+
+	version := n.lru.begin(key)
+	defer n.lru.end(key)
+	info, err := n.store.(types.ObjectStater).Stat(ctx, key)
+	n.remember(key, err, version)
+	return info, err
+}
+
+// Scan builds the bloom filter from a listing of the store, the puts made meanwhile are added to it.
+// The filter is dropped when the listing fails, the reads then reach the store.
+func (n *Negative) Scan(ctx context.Context) error {
+	lister, err := types.Lister(n.store)
+	if nil != err {
+		return err
+	}
+
+	n.lock.Lock()
+	n.building = newBloom(n.expected)
+	n.lock.Unlock()
+
+	var count int
+	begin := time.Now()
+	err = types.WalkObjects(ctx, lister, "", pageSize, func(o types.ObjectInfo) error {
+		n.lock.Lock()
+		n.building.add(o.Key)
+		n.lock.Unlock()
+		count++
+		return nil
+	})
+
+	n.lock.Lock()
+	if n.bloom = n.building; nil != err {
+		n.bloom = nil
+	}
+	n.building = nil
+	n.lock.Unlock()
+
+	n.log.Info("scan bloom filter", zap.Int("objects", count), zap.Int("expected", n.expected), zap.Duration("latency", time.Now().Sub(begin)), zap.Error(err))
+	return err
+}
+
+func (n *Negative) Stats() Stats {
+	objects, _, evicted := n.lru.stats()
+	return Stats{
+		Hits:     atomic.LoadInt64(&n.hits),
+		Misses:   atomic.LoadInt64(&n.misses),
+		Evicted:  evicted,
+		Objects:  objects,
+		Filtered: atomic.LoadInt64(&n.filtered),
+	}
+}
+
+func (n *Negative) missing(key string) bool {
+	if _, ok := n.lru.get(key, time.Now()); ok {
+		atomic.AddInt64(&n.hits, 1)
+		return true
+	}
+
+	n.lock.RLock()
+	absent := nil != n.bloom && !n.bloom.test(key)
+	n.lock.RUnlock()
+	if absent {
+		atomic.AddInt64(&n.filtered, 1)
+		return true
+	}
+
+	atomic.AddInt64(&n.misses, 1)
+	return false
+}
+
+// remember remembers the key as missing unless it was put since begin returned version.
+func (n *Negative) remember(key string, err error, version uint64) {
+	if n.ttl > 0 && types.IsNotFound(err) {
+		n.lru.fill(key, nil, 1, version, time.Now())
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+type __counter struct {
+	types.ObjectClient
+	gets int
+}
+
+func (c *__counter) GetObject(ctx context.Context, key string) ([]byte, error) {
+	c.gets++
+	return c.ObjectClient.GetObject(ctx, key)
+}
+
+func (c *__counter) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return c.ObjectClient.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+func TestNegative_Missing(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := &__counter{ObjectClient: memory.New(log, &types.StoreConfig{Driver: "memory"})}
+	n := NewNegative(log, store, time.Minute, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := n.GetObject(context.Background(), "fake/a"); !types.IsNotFound(err) {
+			t.Error("getObject failed", err)
+		}
+	}
+	if s := n.Stats(); store.gets != 1 || s.Hits != 1 || s.Objects != 1 {
+		t.Error("negative cache failed", s, store.gets)
+	}
+
+	if err := n.PutObject(context.Background(), "fake/a", []byte("aaaa")); nil != err {
+		t.Error("putObject failed", err.Error())
+	}
+	if buf, err := n.GetObject(context.Background(), "fake/a"); nil != err || string(buf) != "aaaa" {
+		t.Error("put not invalidated", err)
+	}
+}
+
+func TestNegative_Bloom(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := &__counter{ObjectClient: memory.New(log, &types.StoreConfig{Driver: "memory"})}
+	for i := 0; i < 100; i++ {
+		store.PutObject(context.Background(), fmt.Sprintf("fake/%d", i), []byte("cccc"))
+	}
+
+	n := NewNegative(log, store, 0, 1000)
+	if _, err := n.GetObject(context.Background(), "fake/missing"); !types.IsNotFound(err) || store.gets != 1 {
+		t.Error("unbuilt filter answered", err)
+	}
+	if err := n.Scan(context.Background()); nil != err {
+		t.Fatal("scan failed", err.Error())
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, err := n.GetObject(context.Background(), fmt.Sprintf("fake/%d", i)); nil != err {
+			t.Error("getObject failed", i, err.Error())
+		}
+	}
+	n.PutObject(context.Background(), "fake/new", []byte("cccc"))
+	if _, err := n.GetObject(context.Background(), "fake/new"); nil != err {
+		t.Error("put not added", err.Error())
+	}
+
+	store.gets = 0
+	for i := 0; i < 100; i++ {
+		if _, err := n.GetObject(context.Background(), fmt.Sprintf("other/%d", i)); !types.IsNotFound(err) {
+			t.Error("getObject failed", i, err)
+		}
+	}
+	if s := n.Stats(); store.gets > 10 || s.Filtered < 90 || s.Objects != 0 {
+		t.Error("bloom filter failed", s, store.gets)
+	}
+
+	store.PutObject(context.Background(), "other/written", []byte("cccc"))
+	if err := n.Scan(context.Background()); nil != err {
+		t.Fatal("scan failed", err.Error())
+	}
+	if _, err := n.GetObject(context.Background(), "other/written"); nil != err {
+		t.Error("other writer missed after rebuild", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"io/ioutil"
+)
+
+type codec struct {
+	id     byte
+	name   string
+	encode func([]byte) ([]byte, error)
+	decode func([]byte) ([]byte, error)
+}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// the ids are stored in the headers, never reuse them
+var codecs = []*codec{
+	{id: 0, name: "none", encode: none, decode: none},
+	{id: 1, name: "gzip", encode: gzipEncode, decode: gzipDecode},
+	{id: 2, name: "snappy", encode: snappyEncode, decode: snappyDecode},
+	{id: 3, name: "zstd", encode: zstdEncode, decode: zstdDecode},
+	{id: 4, name: "lz4", encode: lz4Encode, decode: lz4Decode},
+}
+
+func byName(name string) *codec {
+	for _, c := range codecs {
+		if name == c.name {
+			return c
+		}
+	}
+	return nil
+}
+
+func byId(id byte) *codec {
+	if int(id) < len(codecs) {
+		return codecs[id]
+	}
+	return nil
+}
+
+func none(src []byte) ([]byte, error) {
+	return src, nil
+}
+
+func gzipEncode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); nil != err {
+		return nil, err
+	}
+	if err := w.Close(); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if nil != err {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func snappyEncode(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func snappyDecode(src []byte) ([]byte, error) {
+	return snappy.Decode(nil, src)
+}
+
+func zstdEncode(src []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(src, nil), nil
+}
+
+func zstdDecode(src []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(src, nil)
+}
+
+func lz4Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := lz4.NewWriter(&buf)
+	if _, err := w.Write(src); nil != err {
+		return nil, err
+	}
+	if err := w.Close(); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func lz4Decode(src []byte) ([]byte, error) {
+	return ioutil.ReadAll(lz4.NewReader(bytes.NewReader(src)))
+}
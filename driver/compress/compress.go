@@ -0,0 +1,104 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package compress
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+)
+
+// the header is the magic followed by the id of the codec, objects without it are stored raw
+var magic = []byte("\x89LGZ")
+
+const headerSize = 5
+
+// Compress compresses the objects on put and decompresses them on get,
+// objects which do not shrink are stored raw so chunks are not compressed twice.
+type Compress struct {
+	store types.ObjectClient
+	codec *codec
+}
+
+// Wrap compresses the objects of the store with the codec: gzip, snappy, zstd or lz4.
+func Wrap(store types.ObjectClient, name string) (types.ObjectClient, error) {
+	c := byName(name)
+	if nil == c {
+		return nil, errors.Errorf("can not support compression '%s'", name)
+	}
+	return types.Decorate(&Compress{store: store, codec: c}, store), nil
+}
+
+func (c *Compress) PutObject(ctx context.Context, key string, object []byte) error {
+	buf, err := encode(c.codec, object)
+	if nil != err {
+		return err
+	}
+	utils.Stored(ctx, len(buf))
+	return c.store.PutObject(ctx, key, buf)
+}
+
+func (c *Compress) GetObject(ctx context.Context, key string) ([]byte, error) {
+	buf, err := c.store.GetObject(ctx, key)
+	if nil != err {
+		return buf, err
+	}
+	if buf, err = decode(buf); nil != err {
+		return nil, types.NewError(types.KindCorrupt, key, err)
+	}
+	return buf, nil
+}
+
+func (c *Compress) DeleteObject(ctx context.Context, key string) error {
+	return c.store.DeleteObject(ctx, key)
+}
+
+func (c *Compress) Ping() error {
+	return c.store.Ping()
+}
+
+func (c *Compress) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return c.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+// Stat reports the stored size, which is the compressed one.
+func (c *Compress) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	return c.store.(types.ObjectStater).Stat(ctx, key)
+}
+
+func encode(c *codec, src []byte) ([]byte, error) {
+	dst, err := c.encode(src)
+	if nil != err {
+		return nil, err
+	}
+	if c.id != 0 && len(dst)+headerSize < len(src) {
+		return header(c.id, dst), nil
+	}
+	// raw data looking like a header must be framed to stay readable
+	if bytes.HasPrefix(src, magic) {
+		return header(0, src), nil
+	}
+	return src, nil
+}
+
+func decode(src []byte) ([]byte, error) {
+	if len(src) < headerSize || !bytes.HasPrefix(src, magic) {
+		return src, nil
+	}
+	c := byId(src[len(magic)])
+	if nil == c {
+		return nil, errors.Errorf("unknown compression %d", src[len(magic)])
+	}
+	return c.decode(src[headerSize:])
+}
+
+func header(id byte, src []byte) []byte {
+	dst := make([]byte, headerSize+len(src))
+	copy(dst, magic)
+	dst[len(magic)] = id
+	copy(dst[headerSize:], src)
+	return dst
+}
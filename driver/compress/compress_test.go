@@ -0,0 +1,56 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package compress
+
+import (
+	"bytes"
+	"context"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"math/rand"
+	"testing"
+)
+
+func TestCompress_Object(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+
+	random := make([]byte, 4096)
+	rand.Read(random)
+	objects := map[string][]byte{
+		"text":   bytes.Repeat([]byte("ccccccccccccccccccccccccccccccccc"), 128),
+		"random": random,
+		"magic":  append(append([]byte{}, magic...), 3, 1, 2, 3),
+		"empty":  {},
+	}
+
+	for _, name := range []string{"gzip", "snappy", "zstd", "lz4"} {
+		c, err := Wrap(store, name)
+		if nil != err {
+			t.Fatal("wrap failed", name, err.Error())
+		}
+		for key, src := range objects {
+			if err := c.PutObject(context.Background(), key, src); nil != err {
+				t.Error("putObject failed", name, key, err.Error())
+			}
+			dst, err := c.GetObject(context.Background(), key)
+			if nil != err || !bytes.Equal(src, dst) {
+				t.Error("getObject failed", name, key, err)
+			}
+		}
+
+		raw, _ := store.GetObject(context.Background(), "text")
+		if !bytes.HasPrefix(raw, magic) || raw[len(magic)] == 0 || len(raw) >= len(objects["text"]) {
+			t.Error("compress failed", name, len(raw))
+		}
+		if raw, _ = store.GetObject(context.Background(), "random"); !bytes.Equal(raw, random) {
+			t.Error("incompressible object not raw", name)
+		}
+	}
+
+	if _, err := Wrap(store, "brotli"); nil == err {
+		t.Error("unknown codec accepted")
+	}
+}
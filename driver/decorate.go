@@ -0,0 +1,89 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package driver
+
+import (
+	"fmt"
+	"github/vlorc/loki-grpc-storage/driver/cache"
+	"github/vlorc/loki-grpc-storage/driver/compress"
+	"github/vlorc/loki-grpc-storage/driver/encrypt"
+	"github/vlorc/loki-grpc-storage/driver/flight"
+	"github/vlorc/loki-grpc-storage/schema"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// names counts the stores decorated under each name, the metrics of a store are kept under a name of its own
+var names = struct {
+	sync.Mutex
+	count map[string]int
+}{count: map[string]int{}}
+
+// decorate wraps a driver with the decorators enabled by its config, the innermost first.
+func decorate(log *zap.Logger, config *types.StoreConfig, store types.ObjectClient) (types.ObjectClient, error) {
+	var err error
+
+	name := metric(config.Name)
+
+	if "" != config.Disk && config.DiskSize > 0 {
+		if store, err = cache.WrapDisk(log, store, name, config.Disk, config.DiskSize); nil != err {
+			return nil, err
+		}
+		log.Debug("disk cache", zap.String("path", config.Disk), zap.Int64("bytes", config.DiskSize))
+	}
+
+	if config.Negative > 0 || config.Bloom > 0 {
+		store = cache.WrapNegative(log, store, name, config.Negative, config.Bloom, config.Rescan)
+		log.Debug("negative cache", zap.Duration("ttl", config.Negative), zap.Int("bloom", config.Bloom), zap.Duration("rescan", config.Rescan))
+	}
+
+	if "" != config.Keyring {
+		e, err := encrypt.New(store, config.Keyring, config.Sealed)
+		if nil != err {
+			return nil, err
+		}
+		store = types.Decorate(e, store)
+		log.Debug("encryption", zap.String("keyring", config.Keyring), zap.Bool("sealed", config.Sealed))
+	}
+
+	if "" != config.Compress {
+		if store, err = compress.Wrap(store, config.Compress); nil != err {
+			return nil, err
+		}
+		log.Debug("compression", zap.String("codec", config.Compress))
+	}
+
+	if store, err = schema.Factory(log, config, store); nil != err {
+		return nil, err
+	}
+
+	if config.Coalesce {
+		store = flight.Wrap(store, name)
+		log.Debug("coalesce")
+	}
+
+	if config.Cache > 0 {
+		store = cache.Wrap(store, name, config.Cache, config.Expire)
+		log.Debug("cache", zap.Int64("bytes", config.Cache), zap.Duration("expire", config.Expire))
+	}
+
+	return store, nil
+}
+
+// metric returns the name the metrics of a store are kept under, the stores sharing a name are numbered.
+func metric(name string) string {
+	if "" == name {
+		name = "default"
+	}
+
+	names.Lock()
+	defer names.Unlock()
+
+	names.count[name]++
+	if n := names.count[name]; n > 1 {
+		return fmt.Sprintf("%s#%d", name, n)
+	}
+	return name
+}
@@ -17,7 +17,7 @@ func (e empty) PutObject(ctx context.Context, key string, object []byte) error {
 }
 
 func (e empty) GetObject(ctx context.Context, key string) ([]byte, error) {
-	return nil, nil
+	return nil, types.NotFound(key)
 }
 
 func (e empty) DeleteObject(ctx context.Context, key string) error {
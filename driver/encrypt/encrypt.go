@@ -0,0 +1,88 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+)
+
+// Encrypt seals the objects with AES-GCM under a data key of their own, the data key is wrapped
+// by the active master key whose id is kept in the object so rotated keys still open old objects.
+// Plain objects are returned as they are stored, or rejected as corrupt when strict.
+type Encrypt struct {
+	store  types.ObjectClient
+	ring   *keyring
+	strict bool
+}
+
+var errPlain = errors.New("plain object")
+
+func New(store types.ObjectClient, file string, strict bool) (*Encrypt, error) {
+	ring, err := LoadKeyring(file)
+	if nil != err {
+		return nil, err
+	}
+	return &Encrypt{store: store, ring: ring, strict: strict}, nil
+}
+
+// Wrap encrypts the objects of the store with the keys of the keyring file.
+func Wrap(store types.ObjectClient, file string, strict bool) (types.ObjectClient, error) {
+	e, err := New(store, file, strict)
+	if nil != err {
+		return nil, err
+	}
+	return types.Decorate(e, store), nil
+}
+
+func (e *Encrypt) PutObject(ctx context.Context, key string, object []byte) error {
+	buf, err := e.ring.seal(key, object)
+	if nil != err {
+		return err
+	}
+	utils.Stored(ctx, len(buf))
+	return e.store.PutObject(ctx, key, buf)
+}
+
+func (e *Encrypt) GetObject(ctx context.Context, key string) ([]byte, error) {
+	buf, err := e.store.GetObject(ctx, key)
+	if nil != err {
+		return buf, err
+	}
+	return e.open(key, buf)
+}
+
+func (e *Encrypt) DeleteObject(ctx context.Context, key string) error {
+	return e.store.DeleteObject(ctx, key)
+}
+
+func (e *Encrypt) Ping() error {
+	return e.store.Ping()
+}
+
+func (e *Encrypt) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return e.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+// Stat reports the stored size, which includes the envelope.
+func (e *Encrypt) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	return e.store.(types.ObjectStater).Stat(ctx, key)
+}
+
+func (e *Encrypt) open(key string, buf []byte) ([]byte, error) {
+	if e.strict && !bytes.HasPrefix(buf, magic) {
+		return nil, types.NewError(types.KindCorrupt, key, errPlain)
+	}
+	buf, err := e.ring.open(key, buf)
+	if nil == err {
+		return buf, nil
+	}
+	if errUnknownKey == errors.Cause(err) {
+		return nil, types.NewError(types.KindPermissionDenied, key, err)
+	}
+	return nil, types.NewError(types.KindCorrupt, key, err)
+}
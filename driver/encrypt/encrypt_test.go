@@ -0,0 +1,215 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/schema"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func __keyring(t *testing.T, dir, name, active string, ids ...string) string {
+	ring := &Keyring{Active: active, Keys: map[string]string{}}
+	for _, id := range ids {
+		ring.Keys[id] = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(id[:1]), 32))
+	}
+	buf, _ := json.Marshal(ring)
+	file := filepath.Join(dir, name+".json")
+	if err := ioutil.WriteFile(file, buf, 0644); nil != err {
+		t.Fatal("writeFile failed", err.Error())
+	}
+	return file
+}
+
+var __legacy, _ = schema.Decoder(&types.StoreConfig{})
+
+func TestEncrypt_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encrypt")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	chunk := "fake/81a0e4e6f1b9dd4e:17a1ae0b1e0:17a1ae37bad:2b10a36d"
+	src := []byte("chunk data")
+
+	old, err := New(store, __keyring(t, dir, "old", "a", "a"), false)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	if err := old.PutObject(context.Background(), chunk, src); nil != err {
+		t.Fatal("putObject failed", err.Error())
+	}
+	if raw, _ := store.GetObject(context.Background(), chunk); bytes.Contains(raw, src) || !bytes.HasPrefix(raw, magic) {
+		t.Error("object not sealed")
+	}
+	store.PutObject(context.Background(), "fake/plain", src)
+
+	rotated, err := New(store, __keyring(t, dir, "rotated", "b", "a", "b"), false)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	for _, key := range []string{chunk, "fake/plain"} {
+		if dst, err := rotated.GetObject(context.Background(), key); nil != err || !bytes.Equal(dst, src) {
+			t.Error("getObject failed", key, err)
+		}
+	}
+
+	stats, err := rotated.Rewrap(context.Background(), log, __legacy)
+	if nil != err || stats.Scanned != 2 || stats.Objects != 1 {
+		t.Error("rewrap failed", stats, err)
+	}
+	if raw, _ := store.GetObject(context.Background(), "fake/plain"); !bytes.Equal(raw, src) {
+		t.Error("plain object not chunk sealed")
+	}
+
+	latest, _ := New(store, __keyring(t, dir, "latest", "b", "b"), false)
+	if dst, err := latest.GetObject(context.Background(), chunk); nil != err || !bytes.Equal(dst, src) {
+		t.Error("rewrapped object failed", err)
+	}
+	other, _ := New(store, __keyring(t, dir, "other", "c", "c"), false)
+	if _, err := other.GetObject(context.Background(), chunk); types.KindPermissionDenied != types.KindOf(err) {
+		t.Error("unknown key accepted", err)
+	}
+
+	raw, _ := store.GetObject(context.Background(), chunk)
+	raw[len(raw)-1] ^= 1
+	store.PutObject(context.Background(), chunk, raw)
+	if _, err := latest.GetObject(context.Background(), chunk); types.KindCorrupt != types.KindOf(err) {
+		t.Error("tampered object accepted", err)
+	}
+}
+
+type __deleting struct {
+	*memory.Memory
+}
+
+func (d __deleting) GetObject(ctx context.Context, key string) ([]byte, error) {
+	buf, err := d.Memory.GetObject(ctx, key)
+	_ = d.Memory.DeleteObject(ctx, key)
+	return buf, err
+}
+
+func TestEncrypt_RewrapDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encrypt")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"}).(*memory.Memory)
+	chunk := "fake/81a0e4e6f1b9dd4e:17a1ae0b1e0:17a1ae37bad:2b10a36d"
+	store.PutObject(context.Background(), chunk, []byte("chunk data"))
+
+	e, err := New(__deleting{store}, __keyring(t, dir, "keyring", "a", "a"), false)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	stats, err := e.Rewrap(context.Background(), log, __legacy)
+	if nil != err || stats.Scanned != 1 || stats.Objects != 0 {
+		t.Error("rewrap failed", stats, err)
+	}
+	if _, err := store.GetObject(context.Background(), chunk); !types.IsNotFound(err) {
+		t.Error("deleted object resurrected", err)
+	}
+}
+
+func TestEncrypt_Bound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encrypt")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	chunk := "fake/81a0e4e6f1b9dd4e:17a1ae0b1e0:17a1ae37bad:2b10a36d"
+	src := []byte("chunk data")
+
+	e, err := New(store, __keyring(t, dir, "keyring", "a", "a"), false)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	if err := e.PutObject(context.Background(), chunk, src); nil != err {
+		t.Fatal("putObject failed", err.Error())
+	}
+	raw, _ := store.GetObject(context.Background(), chunk)
+	store.PutObject(context.Background(), "fake/moved", raw)
+	if _, err := e.GetObject(context.Background(), "fake/moved"); types.KindCorrupt != types.KindOf(err) {
+		t.Error("moved object accepted", err)
+	}
+
+	// the first version only bound the magic
+	old, _ := e.ring.wrap("a", bytes.Repeat([]byte("k"), dataKey))
+	old.version = legacy
+	aead, _ := newAEAD(bytes.Repeat([]byte("k"), dataKey))
+	nonce := make([]byte, nonceSize)
+	old.sealed = aead.Seal(nonce, nonce, src, magic)
+	store.PutObject(context.Background(), "fake/legacy", old.marshal())
+	if dst, err := e.GetObject(context.Background(), "fake/legacy"); nil != err || !bytes.Equal(dst, src) {
+		t.Error("legacy envelope failed", err)
+	}
+
+	store.PutObject(context.Background(), "fake/plain", src)
+	if dst, err := e.GetObject(context.Background(), "fake/plain"); nil != err || !bytes.Equal(dst, src) {
+		t.Error("plain object failed", err)
+	}
+	strict, _ := New(store, __keyring(t, dir, "strict", "a", "a"), true)
+	if _, err := strict.GetObject(context.Background(), "fake/plain"); types.KindCorrupt != types.KindOf(err) {
+		t.Error("strict plain object accepted", err)
+	}
+	if dst, err := strict.GetObject(context.Background(), chunk); nil != err || !bytes.Equal(dst, src) {
+		t.Error("strict getObject failed", err)
+	}
+}
+
+func TestEncrypt_RewrapSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encrypt")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	src := []byte("chunk data")
+	keys := map[string]string{
+		"day":    "fake/2021-07-01/81a0e4e6f1b9dd4e/17a1ae0b1e0_17a1ae37bad_2b10a36d",
+		"base64": "ZmFrZS84MWEwZTRlNmYxYjlkZDRlOjE3YTFhZTBiMWUwOjE3YTFhZTM3YmFkOjJiMTBhMzZk",
+	}
+
+	e, err := New(store, __keyring(t, dir, "keyring", "a", "a"), false)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	for name, key := range keys {
+		store.PutObject(context.Background(), key, src)
+		decode, err := schema.Decoder(&types.StoreConfig{Schema: name})
+		if nil != err {
+			t.Fatal("decoder failed", err.Error())
+		}
+		if _, err := e.Rewrap(context.Background(), log, decode); nil != err {
+			t.Error("rewrap failed", name, err)
+		}
+		if raw, _ := store.GetObject(context.Background(), key); !bytes.HasPrefix(raw, magic) {
+			t.Error("chunk not sealed", name)
+		}
+		if dst, err := e.GetObject(context.Background(), key); nil != err || !bytes.Equal(dst, src) {
+			t.Error("getObject failed", name, err)
+		}
+		store.DeleteObject(context.Background(), key)
+	}
+}
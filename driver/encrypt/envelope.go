@@ -0,0 +1,167 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// An envelope is the magic, the version, the key id, the data key wrapped by that master key
+// and the object sealed by the data key:
+//
+//	magic[4] version[1] len[1] id[len] nonce[12] wrapped[48] nonce[12] sealed[...]
+//
+// The object is sealed with the header up to the key id and the object key as additional data,
+// so an envelope can neither be moved to another key nor have its header swapped.
+// The first version only bound the magic and is still opened.
+var magic = []byte("\x89LGE")
+
+const (
+	legacy    = 1
+	version   = 2
+	dataKey   = 32
+	nonceSize = 12
+	wrapSize  = dataKey + 16
+)
+
+var errUnknownKey = errors.New("unknown key id")
+
+type envelope struct {
+	version byte
+	id      string
+	nonce   []byte
+	wrapped []byte
+	sealed  []byte
+}
+
+func (k *keyring) seal(name string, plain []byte) ([]byte, error) {
+	key := make([]byte, dataKey)
+	if _, err := io.ReadFull(rand.Reader, key); nil != err {
+		return nil, err
+	}
+	e, err := k.wrap(k.active, key)
+	if nil != err {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if nil != err {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize, nonceSize+len(plain)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); nil != err {
+		return nil, err
+	}
+	e.sealed = aead.Seal(nonce, nonce, plain, e.additional(name))
+
+	return e.marshal(), nil
+}
+
+func (k *keyring) open(name string, buf []byte) ([]byte, error) {
+	e, err := unmarshal(buf)
+	if nil != err || nil == e {
+		return buf, err
+	}
+	key, err := k.unwrap(e)
+	if nil != err {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key)
+	if nil != err {
+		return nil, err
+	}
+	return aead.Open(nil, e.sealed[:nonceSize], e.sealed[nonceSize:], e.additional(name))
+}
+
+// rewrap seals an object again under the active master key, the key id is bound to the sealed
+// object so it is opened and sealed with a new data key. Plain objects are sealed.
+func (k *keyring) rewrap(name string, buf []byte) ([]byte, bool, error) {
+	e, err := unmarshal(buf)
+	if nil != err {
+		return nil, false, err
+	}
+	if nil != e && k.active == e.id && version == e.version {
+		return buf, false, nil
+	}
+
+	plain, err := k.open(name, buf)
+	if nil != err {
+		return nil, false, err
+	}
+	out, err := k.seal(name, plain)
+	return out, nil == err, err
+}
+
+func (k *keyring) wrap(id string, key []byte) (*envelope, error) {
+	master, ok := k.keys[id]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	e := &envelope{version: version, id: id, nonce: make([]byte, nonceSize)}
+	if _, err := io.ReadFull(rand.Reader, e.nonce); nil != err {
+		return nil, err
+	}
+	e.wrapped = master.Seal(nil, e.nonce, key, []byte(id))
+
+	return e, nil
+}
+
+func (k *keyring) unwrap(e *envelope) ([]byte, error) {
+	master, ok := k.keys[e.id]
+	if !ok {
+		return nil, errors.Wrapf(errUnknownKey, "key '%s'", e.id)
+	}
+	return master.Open(nil, e.nonce, e.wrapped, []byte(e.id))
+}
+
+// header returns the envelope up to the key id.
+func (e *envelope) header(buf []byte) []byte {
+	buf = append(buf, magic...)
+	buf = append(buf, e.version, byte(len(e.id)))
+	return append(buf, e.id...)
+}
+
+// additional returns the additional data the object is sealed with under the key name.
+func (e *envelope) additional(name string) []byte {
+	if legacy == e.version {
+		return magic
+	}
+	return append(e.header(make([]byte, 0, len(magic)+2+len(e.id)+len(name))), name...)
+}
+
+func (e *envelope) marshal() []byte {
+	buf := e.header(make([]byte, 0, len(magic)+2+len(e.id)+nonceSize+wrapSize+len(e.sealed)))
+	buf = append(buf, e.nonce...)
+	buf = append(buf, e.wrapped...)
+	return append(buf, e.sealed...)
+}
+
+// unmarshal returns nil for plain objects.
+func unmarshal(buf []byte) (*envelope, error) {
+	if !bytes.HasPrefix(buf, magic) {
+		return nil, nil
+	}
+	buf = buf[len(magic):]
+	if len(buf) < 2 || (legacy != buf[0] && version != buf[0]) {
+		return nil, errors.New("invalid envelope version")
+	}
+
+	v, n := buf[0], int(buf[1])
+	buf = buf[2:]
+	if len(buf) < n+nonceSize+wrapSize+nonceSize {
+		return nil, errors.New("truncated envelope")
+	}
+
+	return &envelope{
+		version: v,
+		id:      string(buf[:n]),
+		nonce:   buf[n : n+nonceSize],
+		wrapped: buf[n+nonceSize : n+nonceSize+wrapSize],
+		sealed:  buf[n+nonceSize+wrapSize:],
+	}, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+)
+
+// Keyring is the keyring file, the master keys are base64 AES keys of 16, 24 or 32 bytes
+// and new objects are encrypted under the active one.
+type Keyring struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+type keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+func LoadKeyring(file string) (*keyring, error) {
+	buf, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+
+	ring := &Keyring{}
+	if err = json.Unmarshal(buf, ring); nil != err {
+		return nil, errors.Wrapf(err, "invalid keyring '%s'", file)
+	}
+	return newKeyring(ring)
+}
+
+func newKeyring(ring *Keyring) (*keyring, error) {
+	k := &keyring{active: ring.Active, keys: map[string]cipher.AEAD{}}
+	for id, key := range ring.Keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, errors.Errorf("invalid key id '%s'", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if nil != err {
+			return nil, errors.Wrapf(err, "invalid key '%s'", id)
+		}
+		if k.keys[id], err = newAEAD(raw); nil != err {
+			return nil, errors.Wrapf(err, "invalid key '%s'", id)
+		}
+	}
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, errors.Errorf("unknown active key '%s'", k.active)
+	}
+
+	return k, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if nil != err {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -4,13 +4,16 @@
 package driver
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	"github/vlorc/loki-grpc-storage/driver/aliyun"
 	"github/vlorc/loki-grpc-storage/driver/baidu"
+	"github/vlorc/loki-grpc-storage/driver/encrypt"
 	"github/vlorc/loki-grpc-storage/driver/filesystem"
 	"github/vlorc/loki-grpc-storage/driver/http"
 	"github/vlorc/loki-grpc-storage/driver/memory"
 	"github/vlorc/loki-grpc-storage/driver/qiniu"
+	"github/vlorc/loki-grpc-storage/schema"
 	"github/vlorc/loki-grpc-storage/types"
 	"go.uber.org/zap"
 )
@@ -40,8 +43,44 @@ func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 }
 
 func Factory(log *zap.Logger, config *types.StoreConfig) (types.ObjectClient, error) {
-	if factory, ok := driver[config.Driver]; ok {
-		return factory(log.With(zap.String("driver", config.Driver), zap.String("name", config.Name)), config)
+	factory, ok := driver[config.Driver]
+	if !ok {
+		return nil, errors.Errorf("can not support driver '%s'", config.Driver)
 	}
-	return nil, errors.Errorf("can not support driver '%s'", config.Driver)
+
+	log = log.With(zap.String("driver", config.Driver), zap.String("name", config.Name))
+	store, err := factory(log, config)
+	if nil != err {
+		return nil, err
+	}
+
+	return decorate(log, config, store)
+}
+
+// Rewrap wraps the data keys of a store under the active master key of its keyring,
+// the objects are read from the driver itself so no cache is filled on the way.
+func Rewrap(ctx context.Context, log *zap.Logger, config *types.StoreConfig) error {
+	factory, ok := driver[config.Driver]
+	if !ok {
+		return errors.Errorf("can not support driver '%s'", config.Driver)
+	}
+
+	log = log.With(zap.String("driver", config.Driver), zap.String("name", config.Name))
+	store, err := factory(log, config)
+	if nil != err {
+		return err
+	}
+	decode, err := schema.Decoder(config)
+	if nil != err {
+		return err
+	}
+	e, err := encrypt.New(store, config.Keyring, config.Sealed)
+	if nil != err {
+		return err
+	}
+	stats, err := e.Rewrap(ctx, log, decode)
+	if nil == err && stats.Failed > 0 {
+		err = errors.Errorf("rewrap %d objects failed", stats.Failed)
+	}
+	return err
 }
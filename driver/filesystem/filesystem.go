@@ -19,7 +19,11 @@ type FS struct {
 	log       *zap.Logger
 }
 
+var encoder = utils.PathEncoder
+
 var _ types.ObjectClient = &FS{}
+var _ types.ObjectLister = &FS{}
+var _ types.ObjectStater = &FS{}
 
 func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 	fs, err := Factory(log, config)
@@ -40,21 +44,38 @@ func Factory(log *zap.Logger, config *types.StoreConfig) (types.ObjectClient, er
 }
 
 func (fs *FS) PutObject(ctx context.Context, key string, object []byte) error {
-	return fs.write(ctx, key, object)
+	return classify(key, fs.write(ctx, encoder.Encode(key), object))
 }
 
 func (fs *FS) GetObject(ctx context.Context, key string) ([]byte, error) {
-	return fs.read(ctx, key)
+	buf, err := fs.read(ctx, encoder.Encode(key))
+	return buf, classify(key, err)
 }
 
 func (fs *FS) DeleteObject(ctx context.Context, key string) error {
-	return fs.remove(ctx, key)
+	return classify(key, fs.remove(ctx, encoder.Encode(key)))
 }
 
 func (fs *FS) Ping() error {
 	return fs.ping()
 }
 
+func (fs *FS) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	info, err := fs.stat(ctx, encoder.Encode(key))
+	if nil != info {
+		info.Key = key
+	}
+	return info, classify(key, err)
+}
+
+func (fs *FS) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	objects, next, err := fs.list(ctx, encoder.Encode(prefix), encoder.Encode(after), limit)
+	for i := range objects {
+		objects[i].Key = utils.DecodeKey(encoder, objects[i].Key)
+	}
+	return objects, utils.DecodeKey(encoder, next), classify(prefix, err)
+}
+
 func (fs *FS) ping() error {
 	stat, err := os.Stat(fs.Directory)
 	if nil != err {
@@ -111,6 +132,104 @@ func (fs *FS) read(ctx context.Context, key string) ([]byte, error) {
 	return utils.ReadFile(p)
 }
 
+func (fs *FS) stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	p, err := realpath(fs.Directory, key)
+	if nil != err {
+		return nil, err
+	}
+
+	stat, err := os.Stat(p)
+	if nil != err {
+		if os.IsNotExist(err) {
+			err = types.NotFound(key)
+		}
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, types.NotFound(key)
+	}
+
+	return &types.ObjectInfo{Key: key, Size: stat.Size(), Modified: stat.ModTime()}, nil
+}
+
+// list walks the files in the order of their path segments, which is the order of filepath.Walk,
+// and stops once the page is full, skipping the directories before the page.
+func (fs *FS) list(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	base, err := realpath(fs.Directory, prefix[:strings.LastIndexByte(prefix, '/')+1])
+	if nil != err {
+		return nil, "", err
+	}
+
+	var objects []types.ObjectInfo
+	err = filepath.Walk(base, func(p string, info os.FileInfo, err error) error {
+		if nil != err {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(fs.Directory, p)
+		if nil != err {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if p != base && skipDir(key+"/", prefix, after) {
+				return filepath.SkipDir
+			}
+			return ctx.Err()
+		}
+		if !strings.HasPrefix(key, prefix) || ("" != after && !segmentLess(after, key)) {
+			return nil
+		}
+		objects = append(objects, types.ObjectInfo{Key: key, Size: info.Size(), Modified: info.ModTime()})
+		if limit > 0 && len(objects) > limit {
+			return errPageFull
+		}
+		return nil
+	})
+	if nil != err && errPageFull != err {
+		return nil, "", err
+	}
+	if limit > 0 && len(objects) > limit {
+		objects = objects[:limit]
+		return objects, objects[limit-1].Key, nil
+	}
+	return objects, "", nil
+}
+
+var errPageFull = errors.New("page full")
+
+// skipDir reports a directory holding no key of the prefix, or only keys up to after.
+func skipDir(dir, prefix, after string) bool {
+	if !strings.HasPrefix(dir, prefix) && !strings.HasPrefix(prefix, dir) {
+		return true
+	}
+	return "" != after && !strings.HasPrefix(after, dir) && segmentLess(dir, after)
+}
+
+// segmentLess compares keys segment by segment, "a/b" is before "a-c" as "a" is before "a-c".
+func segmentLess(a, b string) bool {
+	for {
+		i, j := strings.IndexByte(a, '/'), strings.IndexByte(b, '/')
+		sa, sb := a, b
+		if i >= 0 {
+			sa = a[:i]
+		}
+		if j >= 0 {
+			sb = b[:j]
+		}
+		if sa != sb {
+			return sa < sb
+		}
+		if i < 0 || j < 0 {
+			return i < 0 && j >= 0
+		}
+		a, b = a[i+1:], b[j+1:]
+	}
+}
+
 func (fs *FS) mkdir(p string) bool {
 	dir := filepath.Dir(p)
 	if err := os.MkdirAll(dir, 0755); nil != err {
@@ -122,6 +241,20 @@ func (fs *FS) mkdir(p string) bool {
 	return true
 }
 
+// Path returns the file storing the key below the root directory, keys escaping it are invalid.
+func Path(root, key string) (string, error) {
+	return realpath(root, encoder.Encode(key))
+}
+
+// Key returns the key stored in a file below the root directory.
+func Key(root, p string) (string, error) {
+	rel, err := filepath.Rel(root, p)
+	if nil != err {
+		return "", err
+	}
+	return utils.DecodeKey(encoder, filepath.ToSlash(rel)), nil
+}
+
 func realpath(root, name string) (string, error) {
 	p := filepath.Join(root, filepath.FromSlash(name))
 	p, err := filepath.Abs(p)
@@ -129,8 +262,12 @@ func realpath(root, name string) (string, error) {
 		return "", err
 	}
 	if !strings.HasPrefix(p, root) {
-		return "", errors.Errorf("invalid path %s to %s", name, p)
+		return "", types.NewError(types.KindInvalidKey, name, errors.Errorf("invalid path %s to %s", name, p))
 	}
 
 	return p, nil
 }
+
+func classify(key string, err error) error {
+	return types.NewError(types.KindOfError(err), key, err)
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"github/vlorc/loki-grpc-storage/types"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"os"
 	"testing"
 )
@@ -42,3 +43,110 @@ func TestFilesystem_Object(t *testing.T) {
 		t.Error("delObject", err.Error())
 	}
 }
+
+func TestFilesystem_List(t *testing.T) {
+	d := __new()
+	keys := []string{"list/b/" + __id, "list/a/" + __id, "list/a0", "other"}
+
+	for _, k := range keys {
+		if err := d.PutObject(context.Background(), k, []byte("cccc")); nil != err {
+			t.Error("putObject failed", err.Error())
+		}
+	}
+	defer func() {
+		for _, k := range keys {
+			_ = d.DeleteObject(context.Background(), k)
+		}
+	}()
+
+	objects, next, err := d.(types.ObjectLister).ListObjects(context.Background(), "list/", "", 2)
+	if nil != err || len(objects) != 2 || objects[0].Key != keys[1] || objects[1].Key != keys[2] || next != keys[2] {
+		t.Error("listObjects failed", objects, next, err)
+	}
+	objects, next, err = d.(types.ObjectLister).ListObjects(context.Background(), "list/", next, 2)
+	if nil != err || len(objects) != 1 || objects[0].Key != keys[0] || objects[0].Size != 4 || "" != next {
+		t.Error("listObjects failed", objects, next, err)
+	}
+}
+
+func TestFilesystem_Stat(t *testing.T) {
+	d := __new()
+
+	if err := d.PutObject(context.Background(), __id, []byte("cccc")); nil != err {
+		t.Error("putObject failed", err.Error())
+	}
+	info, err := d.(types.ObjectStater).Stat(context.Background(), __id)
+	if nil != err || info.Size != 4 || info.Modified.IsZero() {
+		t.Error("stat failed", info, err)
+	}
+	if err := d.DeleteObject(context.Background(), __id); nil != err {
+		t.Error("delObject", err.Error())
+	}
+	if _, err = d.(types.ObjectStater).Stat(context.Background(), __id); !types.IsNotFound(err) {
+		t.Error("stat not found failed", err)
+	}
+}
+
+func TestFilesystem_Encode(t *testing.T) {
+	d := __new()
+	keys := []string{"encode/a:b", "encode/a_b", "encode/..", "encode/a?b"}
+
+	for _, k := range keys {
+		if err := d.PutObject(context.Background(), k, []byte(k)); nil != err {
+			t.Error("putObject failed", err.Error())
+		}
+	}
+	defer func() {
+		for _, k := range keys {
+			_ = d.DeleteObject(context.Background(), k)
+		}
+	}()
+
+	for _, k := range keys {
+		if buf, err := d.GetObject(context.Background(), k); nil != err || string(buf) != k {
+			t.Error("getObject failed", k, string(buf), err)
+		}
+	}
+	objects, _, err := d.(types.ObjectLister).ListObjects(context.Background(), "encode/", "", 0)
+	if nil != err || len(objects) != len(keys) {
+		t.Fatal("listObjects failed", objects, err)
+	}
+	for _, o := range objects {
+		if buf, _ := d.GetObject(context.Background(), o.Key); string(buf) != o.Key {
+			t.Error("listObjects key failed", o.Key)
+		}
+	}
+}
+
+func TestFilesystem_Walk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "walk")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	log, _ := zap.NewDevelopment()
+	d := New(log, &types.StoreConfig{Driver: "fs", Url: dir})
+	keys := []string{"a/b", "a-c", "a/b0/c", "a/b-d", "b", "ab/c"}
+	for _, k := range keys {
+		if err := d.PutObject(context.Background(), k, []byte("cccc")); nil != err {
+			t.Fatal("putObject failed", err.Error())
+		}
+	}
+
+	for _, limit := range []int{1, 2, 0} {
+		seen := map[string]int{}
+		if err := types.WalkObjects(context.Background(), d.(types.ObjectLister), "", limit, func(o types.ObjectInfo) error {
+			seen[o.Key]++
+			return nil
+		}); nil != err {
+			t.Fatal("walkObjects failed", err.Error())
+		}
+		for _, k := range keys {
+			if seen[k] != 1 || len(seen) != len(keys) {
+				t.Error("walkObjects failed", limit, seen)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package flight
+
+import (
+	"context"
+	"expvar"
+	"github/vlorc/loki-grpc-storage/types"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var flights = expvar.NewMap("store_flight")
+
+// Stats are the counters of a flight, published in expvar under store_flight by store name.
+type Stats struct {
+	Calls int64 `json:"calls"`
+	Saved int64 `json:"saved"`
+}
+
+type call struct {
+	done    chan struct{}
+	buf     []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Flight coalesces concurrent reads of one key into a single read of the store, whose result is
+// handed to every caller, the returned objects are shared and must not be modified.
+// The read keeps going as long as one caller waits for it.
+type Flight struct {
+	calls int64
+	saved int64
+	store types.ObjectClient
+	lock  sync.Mutex
+	keys  map[string]*call
+}
+
+func New(store types.ObjectClient) *Flight {
+	return &Flight{store: store, keys: map[string]*call{}}
+}
+
+// Wrap coalesces the reads of the store.
+func Wrap(store types.ObjectClient, name string) types.ObjectClient {
+	f := New(store)
+	flights.Set(name, expvar.Func(func() interface{} {
+		return f.Stats()
+	}))
+	return types.Decorate(f, store)
+}
+
+func (f *Flight) GetObject(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	f.lock.Lock()
+	c, ok := f.keys[key]
+	if ok {
+		atomic.AddInt64(&f.saved, 1)
+	} else {
+		atomic.AddInt64(&f.calls, 1)
+		c = &call{done: make(chan struct{})}
+		var child context.Context
+		child, c.cancel = context.WithCancel(detach(ctx))
+		f.keys[key] = c
+		go f.do(child, key, c)
+	}
+	c.waiters++
+	f.lock.Unlock()
+
+	select {
+	case <-c.done:
+		return c.buf, c.err
+	case <-ctx.Done():
+		f.leave(key, c)
+		return nil, ctx.Err()
+	}
+}
+
+func (f *Flight) PutObject(ctx context.Context, key string, object []byte) error {
+	f.forget(key)
+	return f.store.PutObject(ctx, key, object)
+}
+
+func (f *Flight) DeleteObject(ctx context.Context, key string) error {
+	f.forget(key)
+	return f.store.DeleteObject(ctx, key)
+}
+
+func (f *Flight) Ping() error {
+	return f.store.Ping()
+}
+
+func (f *Flight) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return f.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+func (f *Flight) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	return f.store.(types.ObjectStater).Stat(ctx, key)
+}
+
+func (f *Flight) Stats() Stats {
+	return Stats{Calls: atomic.LoadInt64(&f.calls), Saved: atomic.LoadInt64(&f.saved)}
+}
+
+func (f *Flight) do(ctx context.Context, key string, c *call) {
+	c.buf, c.err = f.store.GetObject(ctx, key)
+	c.cancel()
+
+	f.lock.Lock()
+	if f.keys[key] == c {
+		delete(f.keys, key)
+	}
+	f.lock.Unlock()
+	close(c.done)
+}
+
+// forget detaches the read of a key being written, the callers reading after the write
+// start a read of their own instead of joining one which may return the old object.
+func (f *Flight) forget(key string) {
+	f.lock.Lock()
+	delete(f.keys, key)
+	f.lock.Unlock()
+}
+
+// leave cancels the read once its last caller is gone, later callers start a read of their own.
+func (f *Flight) leave(key string, c *call) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if c.waiters--; c.waiters > 0 {
+		return
+	}
+	if f.keys[key] == c {
+		delete(f.keys, key)
+	}
+	c.cancel()
+}
+
+// detached keeps the values of a context, such as the table, without its deadline and cancellation,
+// which belong to the caller rather than to the shared read.
+type detached struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
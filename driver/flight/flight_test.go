@@ -0,0 +1,132 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package flight
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type __slow struct {
+	types.ObjectClient
+	calls   int32
+	release chan struct{}
+}
+
+func (s *__slow) GetObject(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt32(&s.calls, 1)
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.ObjectClient.GetObject(ctx, key)
+}
+
+func __new() (*__slow, *Flight) {
+	log, _ := zap.NewDevelopment()
+	store := &__slow{ObjectClient: memory.New(log, &types.StoreConfig{Driver: "memory"}), release: make(chan struct{})}
+	store.PutObject(context.Background(), "a", []byte("aaaa"))
+	return store, New(store)
+}
+
+func TestFlight_Coalesce(t *testing.T) {
+	store, f := __new()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if buf, err := f.GetObject(context.Background(), "a"); nil != err || string(buf) != "aaaa" {
+				t.Error("getObject failed", string(buf), err)
+			}
+		}()
+	}
+	for f.Stats().Calls+f.Stats().Saved < 8 {
+		time.Sleep(time.Millisecond)
+	}
+	close(store.release)
+	wg.Wait()
+
+	if s := f.Stats(); s.Calls != 1 || s.Saved != 7 || atomic.LoadInt32(&store.calls) != 1 {
+		t.Error("coalesce failed", s, store.calls)
+	}
+	if _, err := f.GetObject(context.Background(), "b"); !types.IsNotFound(err) {
+		t.Error("getObject failed", err)
+	}
+}
+
+func TestFlight_Cancel(t *testing.T) {
+	store, f := __new()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := f.GetObject(ctx, "a")
+		done <- err
+	}()
+	go func() {
+		buf, err := f.GetObject(context.Background(), "a")
+		if nil == err && string(buf) != "aaaa" {
+			err = context.Canceled
+		}
+		done <- err
+	}()
+	for f.Stats().Calls+f.Stats().Saved < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; context.Canceled != err {
+		t.Error("cancel failed", err)
+	}
+	close(store.release)
+	if err := <-done; nil != err {
+		t.Error("shared read cancelled", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.GetObject(ctx, "a"); context.Canceled != err {
+		t.Error("cancelled caller waited", err)
+	}
+}
+
+func TestFlight_Write(t *testing.T) {
+	store, f := __new()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.GetObject(context.Background(), "a")
+	}()
+	for f.Stats().Calls < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := f.PutObject(context.Background(), "a", []byte("bbbb")); nil != err {
+		t.Fatal("putObject failed", err.Error())
+	}
+	go func() {
+		for f.Stats().Calls < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		close(store.release)
+	}()
+	if buf, err := f.GetObject(context.Background(), "a"); nil != err || string(buf) != "bbbb" {
+		t.Error("getObject after put failed", string(buf), err)
+	}
+	<-done
+
+	if s := f.Stats(); s.Calls != 2 || s.Saved != 0 || atomic.LoadInt32(&store.calls) != 2 {
+		t.Error("read joined across put", s, store.calls)
+	}
+}
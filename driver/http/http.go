@@ -21,7 +21,10 @@ type HTTP struct {
 	client *http.Client
 }
 
+var encoder = utils.URLEncoder
+
 var _ types.ObjectClient = &HTTP{}
+var _ types.ObjectStater = &HTTP{}
 
 func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 	fs, err := Factory(log, config)
@@ -44,21 +47,30 @@ func Factory(log *zap.Logger, config *types.StoreConfig) (types.ObjectClient, er
 }
 
 func (h *HTTP) PutObject(ctx context.Context, key string, object []byte) error {
-	return h.write(ctx, key, object)
+	return classify(key, h.write(ctx, encoder.Encode(key), object))
 }
 
 func (h *HTTP) GetObject(ctx context.Context, key string) ([]byte, error) {
-	return h.read(ctx, key)
+	buf, err := h.read(ctx, encoder.Encode(key))
+	return buf, classify(key, err)
 }
 
 func (h *HTTP) DeleteObject(ctx context.Context, key string) error {
-	return h.remove(ctx, key)
+	return classify(key, h.remove(ctx, encoder.Encode(key)))
 }
 
 func (h *HTTP) Ping() error {
 	return nil
 }
 
+func (h *HTTP) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	info, err := h.stat(ctx, encoder.Encode(key))
+	if nil != info {
+		info.Key = key
+	}
+	return info, classify(key, err)
+}
+
 func (h *HTTP) remove(ctx context.Context, key string) error {
 	_, err := h.request(ctx, http.MethodDelete, key, nil, utils.ReadNop)
 
@@ -75,8 +87,32 @@ func (h *HTTP) read(ctx context.Context, key string) ([]byte, error) {
 	return h.request(ctx, http.MethodGet, key, nil, utils.ReadAll)
 }
 
+func (h *HTTP) stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	var info *types.ObjectInfo
+	_, err := h.do(ctx, http.MethodHead, key, nil, func(resp *http.Response) ([]byte, error) {
+		modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		info = &types.ObjectInfo{
+			Key:      key,
+			Size:     resp.ContentLength,
+			Modified: modified,
+			Checksum: strings.Trim(resp.Header.Get("ETag"), `"`),
+		}
+		return nil, nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	return info, nil
+}
+
 func (h *HTTP) request(ctx context.Context, method string, key string, body io.Reader, read func(io.Reader) ([]byte, error)) ([]byte, error) {
-	rawurl := h.url + strings.ReplaceAll(key, ":", "_")
+	return h.do(ctx, method, key, body, func(resp *http.Response) ([]byte, error) {
+		return read(resp.Body)
+	})
+}
+
+func (h *HTTP) do(ctx context.Context, method string, key string, body io.Reader, read func(*http.Response) ([]byte, error)) ([]byte, error) {
+	rawurl := h.url + key
 
 	req, err := http.NewRequestWithContext(ctx, method, rawurl, body)
 	if nil != err {
@@ -93,8 +129,12 @@ func (h *HTTP) request(ctx context.Context, method string, key string, body io.R
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = errors.Errorf("http status %d", resp.StatusCode)
+		err = types.NewError(types.KindOfStatus(resp.StatusCode), key, errors.Errorf("http status %d", resp.StatusCode))
 		return nil, err
 	}
-	return read(resp.Body)
+	return read(resp)
+}
+
+func classify(key string, err error) error {
+	return types.NewError(types.KindOfError(err), key, err)
 }
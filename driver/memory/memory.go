@@ -7,16 +7,22 @@ import (
 	"context"
 	"github/vlorc/loki-grpc-storage/types"
 	"go.uber.org/zap"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Memory struct {
 	mtx     sync.RWMutex
 	objects map[string][]byte
+	times   map[string]time.Time
 	log     *zap.Logger
 }
 
 var _ types.ObjectClient = &Memory{}
+var _ types.ObjectLister = &Memory{}
+var _ types.ObjectStater = &Memory{}
 
 func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 	fs, err := Factory(log, config)
@@ -27,14 +33,15 @@ func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 }
 
 func Factory(log *zap.Logger, _ *types.StoreConfig) (types.ObjectClient, error) {
-	return &Memory{objects: map[string][]byte{}, log: log}, nil
+	return &Memory{objects: map[string][]byte{}, times: map[string]time.Time{}, log: log}, nil
 }
 
 func (mm *Memory) PutObject(ctx context.Context, key string, object []byte) error {
-	mm.mtx.RLock()
-	defer mm.mtx.RUnlock()
+	mm.mtx.Lock()
+	defer mm.mtx.Unlock()
 
 	mm.objects[key] = object
+	mm.times[key] = time.Now()
 	return nil
 }
 
@@ -42,7 +49,10 @@ func (mm *Memory) GetObject(ctx context.Context, key string) ([]byte, error) {
 	mm.mtx.RLock()
 	defer mm.mtx.RUnlock()
 
-	buf := mm.objects[key]
+	buf, ok := mm.objects[key]
+	if !ok {
+		return nil, types.NotFound(key)
+	}
 	return buf, nil
 }
 
@@ -50,10 +60,47 @@ func (mm *Memory) DeleteObject(ctx context.Context, key string) error {
 	mm.mtx.Lock()
 	defer mm.mtx.Unlock()
 
+	if _, ok := mm.objects[key]; !ok {
+		return types.NotFound(key)
+	}
 	delete(mm.objects, key)
+	delete(mm.times, key)
 	return nil
 }
 
 func (mm *Memory) Ping() error {
 	return nil
 }
+
+func (mm *Memory) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	mm.mtx.RLock()
+	defer mm.mtx.RUnlock()
+
+	buf, ok := mm.objects[key]
+	if !ok {
+		return nil, types.NotFound(key)
+	}
+	return &types.ObjectInfo{Key: key, Size: int64(len(buf)), Modified: mm.times[key]}, nil
+}
+
+func (mm *Memory) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	mm.mtx.RLock()
+	defer mm.mtx.RUnlock()
+
+	var objects []types.ObjectInfo
+	for k, v := range mm.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			objects = append(objects, types.ObjectInfo{Key: k, Size: int64(len(v)), Modified: mm.times[k]})
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	if limit > 0 && len(objects) > limit {
+		objects = objects[:limit]
+		return objects, objects[limit-1].Key, nil
+	}
+
+	return objects, "", nil
+}
@@ -40,3 +40,55 @@ func TestMemory_Object(t *testing.T) {
 		t.Error("delObject", err.Error())
 	}
 }
+
+func TestMemory_List(t *testing.T) {
+	d := __new()
+	keys := []string{"list/b/" + __id, "list/a/" + __id, "list/a0", "other"}
+
+	for _, k := range keys {
+		if err := d.PutObject(context.Background(), k, []byte("cccc")); nil != err {
+			t.Error("putObject failed", err.Error())
+		}
+	}
+	defer func() {
+		for _, k := range keys {
+			_ = d.DeleteObject(context.Background(), k)
+		}
+	}()
+
+	objects, next, err := d.(types.ObjectLister).ListObjects(context.Background(), "list/", "", 2)
+	if nil != err || len(objects) != 2 || objects[0].Key != keys[1] || objects[1].Key != keys[2] || next != keys[2] {
+		t.Error("listObjects failed", objects, next, err)
+	}
+	objects, next, err = d.(types.ObjectLister).ListObjects(context.Background(), "list/", next, 2)
+	if nil != err || len(objects) != 1 || objects[0].Key != keys[0] || objects[0].Size != 4 || "" != next {
+		t.Error("listObjects failed", objects, next, err)
+	}
+}
+
+func TestMemory_Stat(t *testing.T) {
+	d := __new()
+
+	if err := d.PutObject(context.Background(), __id, []byte("cccc")); nil != err {
+		t.Error("putObject failed", err.Error())
+	}
+	info, err := d.(types.ObjectStater).Stat(context.Background(), __id)
+	if nil != err || info.Size != 4 || info.Modified.IsZero() {
+		t.Error("stat failed", info, err)
+	}
+	if err := d.DeleteObject(context.Background(), __id); nil != err {
+		t.Error("delObject", err.Error())
+	}
+	if _, err = d.(types.ObjectStater).Stat(context.Background(), __id); !types.IsNotFound(err) {
+		t.Error("stat not found failed", err)
+	}
+}
+
+func TestMemory_NotFound(t *testing.T) {
+	if _, err := __new().GetObject(context.Background(), __id); !types.IsNotFound(err) {
+		t.Error("getObject not found failed", err)
+	}
+	if err := __new().DeleteObject(context.Background(), __id); !types.IsNotFound(err) {
+		t.Error("delObject not found failed", err)
+	}
+}
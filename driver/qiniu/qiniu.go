@@ -7,6 +7,7 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"github.com/qiniu/go-sdk/v7/auth"
+	"github.com/qiniu/go-sdk/v7/client"
 	"github.com/qiniu/go-sdk/v7/sms/bytes"
 	"github.com/qiniu/go-sdk/v7/storage"
 	"github/vlorc/loki-grpc-storage/types"
@@ -29,7 +30,11 @@ type Qiniu struct {
 	mkUrl    func(*auth.Credentials, string, string) string
 }
 
+var encoder = utils.ObjectEncoder
+
 var _ types.ObjectClient = &Qiniu{}
+var _ types.ObjectLister = &Qiniu{}
+var _ types.ObjectStater = &Qiniu{}
 
 func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
 	qn, err := Factory(log, config)
@@ -82,15 +87,16 @@ func Factory(log *zap.Logger, config *types.StoreConfig) (types.ObjectClient, er
 }
 
 func (qn *Qiniu) PutObject(ctx context.Context, key string, object []byte) error {
-	return qn.write(ctx, key, object)
+	return classify(key, qn.write(ctx, encoder.Encode(key), object))
 }
 
 func (qn *Qiniu) GetObject(ctx context.Context, key string) ([]byte, error) {
-	return qn.read(ctx, key)
+	buf, err := qn.read(ctx, encoder.Encode(key))
+	return buf, classify(key, err)
 }
 
 func (qn *Qiniu) DeleteObject(ctx context.Context, key string) error {
-	return qn.remove(ctx, key)
+	return classify(key, qn.remove(ctx, encoder.Encode(key)))
 }
 
 func (qn *Qiniu) Ping() error {
@@ -103,6 +109,22 @@ func (qn *Qiniu) Ping() error {
 	return nil
 }
 
+func (qn *Qiniu) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	info, err := qn.stat(ctx, encoder.Encode(key))
+	if nil != info {
+		info.Key = key
+	}
+	return info, classify(key, err)
+}
+
+func (qn *Qiniu) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	objects, next, err := qn.list(ctx, encoder.Encode(prefix), after, limit)
+	for i := range objects {
+		objects[i].Key = utils.DecodeKey(encoder, objects[i].Key)
+	}
+	return objects, next, classify(prefix, err)
+}
+
 func (qn *Qiniu) remove(ctx context.Context, key string) error {
 	host, err := qn.manager.RsReqHost(qn.bucket)
 	if err != nil {
@@ -141,9 +163,62 @@ func (qn *Qiniu) read(ctx context.Context, key string) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = errors.Errorf("http status %d", resp.StatusCode)
+		err = types.NewError(types.KindOfStatus(resp.StatusCode), key, errors.Errorf("http status %d", resp.StatusCode))
 		return nil, err
 	}
 
 	return utils.ReadAll(resp.Body)
 }
+
+func (qn *Qiniu) stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	info, err := qn.manager.Stat(qn.bucket, key)
+	if nil != err {
+		return nil, err
+	}
+
+	return &types.ObjectInfo{
+		Key:      key,
+		Size:     info.Fsize,
+		Modified: time.Unix(0, info.PutTime*100),
+		Checksum: info.Hash,
+	}, nil
+}
+
+func (qn *Qiniu) list(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	// the marker of qiniu is the continuation, it is passed back as it is
+	items, _, marker, more, err := qn.manager.ListFiles(qn.bucket, prefix, "", after, limit)
+	if nil != err {
+		return nil, "", err
+	}
+
+	objects := make([]types.ObjectInfo, len(items))
+	for i, o := range items {
+		objects[i] = types.ObjectInfo{Key: o.Key, Size: o.Fsize, Modified: time.Unix(0, o.PutTime*100)}
+	}
+	if more {
+		return objects, marker, nil
+	}
+
+	return objects, "", nil
+}
+
+func classify(key string, err error) error {
+	e, ok := errors.Cause(err).(*client.ErrorInfo)
+	if !ok {
+		return types.NewError(types.KindOfError(err), key, err)
+	}
+
+	switch e.Code {
+	case 612:
+		return types.NewError(types.KindNotFound, key, err)
+	case 573:
+		return types.NewError(types.KindThrottled, key, err)
+	case 599:
+		return types.NewError(types.KindUnavailable, key, err)
+	}
+	return types.NewError(types.KindOfStatus(e.Code), key, err)
+}
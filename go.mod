@@ -3,13 +3,18 @@ module github/vlorc/loki-grpc-storage
 go 1.16
 
 require (
-	github.com/aliyun/aliyun-oss-go-sdk v2.1.9+incompatible // indirect
-	github.com/baidubce/bce-sdk-go v0.9.79 // indirect
+	github.com/aliyun/aliyun-oss-go-sdk v2.1.9+incompatible
+	github.com/baidubce/bce-sdk-go v0.9.79
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/protobuf v1.5.2
+	github.com/golang/snappy v0.0.4
+	github.com/klauspost/compress v1.13.6
+	github.com/pierrec/lz4/v4 v4.1.12
 	github.com/pkg/errors v0.8.1
 	github.com/qiniu/go-sdk/v7 v7.9.7
+	go.etcd.io/bbolt v1.3.6
 	go.uber.org/zap v1.18.1
-	golang.org/x/time v0.0.0-20210611083556-38a9dc6acbc6 // indirect
+	golang.org/x/time v0.0.0-20210611083556-38a9dc6acbc6
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
 	google.golang.org/grpc v1.39.0
 )
@@ -0,0 +1,183 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const separator = "\000"
+
+type Bolt struct {
+	log   *zap.Logger
+	db    *bbolt.DB
+	batch int
+}
+
+var _ types.IndexClient = &Bolt{}
+
+func New(log *zap.Logger, config *types.IndexConfig) types.IndexClient {
+	b, err := Factory(log, config, nil)
+	if nil != err {
+		panic(err)
+	}
+	return b
+}
+
+func Factory(log *zap.Logger, config *types.IndexConfig, _ types.ObjectClient) (types.IndexClient, error) {
+	root, err := filepath.Abs(filepath.Clean(config.Url))
+	if nil != err {
+		return nil, err
+	}
+	if err = os.MkdirAll(root, 0755); nil != err {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(filepath.Join(root, "index.db"), 0644, &bbolt.Options{Timeout: 5 * time.Second})
+	if nil != err {
+		return nil, err
+	}
+
+	b := &Bolt{
+		log:   log,
+		db:    db,
+		batch: config.Batch,
+	}
+	if b.batch <= 0 {
+		b.batch = 256
+	}
+
+	return b, nil
+}
+
+func (b *Bolt) WriteIndex(ctx context.Context, entries []*api.IndexEntry) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		for _, e := range entries {
+			bucket, err := tx.CreateBucketIfNotExists([]byte(e.GetTableName()))
+			if nil != err {
+				return err
+			}
+			if err = bucket.Put(rowKey(e.GetHashValue(), e.GetRangeValue()), e.GetValue()); nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// QueryIndex reads a batch of rows in a transaction of its own and closes it before the callback,
+// a slow caller never keeps a transaction open.
+func (b *Bolt) QueryIndex(ctx context.Context, query *api.QueryIndexRequest, callback func([]*api.Row) error) error {
+	prefix, start := bounds(query)
+
+	for nil != start {
+		if err := ctx.Err(); nil != err {
+			return err
+		}
+
+		var rows []*api.Row
+		err := b.db.View(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket([]byte(query.GetTableName()))
+			if nil == bucket {
+				start = nil
+				return nil
+			}
+			rows, start = scan(bucket.Cursor(), query, prefix, start, b.batch)
+			return nil
+		})
+		if nil != err {
+			return err
+		}
+		if len(rows) > 0 {
+			if err = callback(rows); nil != err {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Bolt) DeleteIndex(ctx context.Context, entries []*api.IndexEntry) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		for _, e := range entries {
+			bucket := tx.Bucket([]byte(e.GetTableName()))
+			if nil == bucket {
+				continue
+			}
+			if err := bucket.Delete(rowKey(e.GetHashValue(), e.GetRangeValue())); nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) DeleteTable(ctx context.Context, name string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(name)); nil != err && bbolt.ErrBucketNotFound != err {
+			return err
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+func rowKey(hash string, rangeValue []byte) []byte {
+	k := make([]byte, 0, len(hash)+len(separator)+len(rangeValue))
+	k = append(k, hash...)
+	k = append(k, separator...)
+	k = append(k, rangeValue...)
+	return k
+}
+
+func bounds(query *api.QueryIndexRequest) (prefix, start []byte) {
+	prefix = rowKey(query.GetHashValue(), nil)
+	start = prefix
+
+	if p := query.GetRangeValuePrefix(); len(p) > 0 {
+		prefix = rowKey(query.GetHashValue(), p)
+		start = prefix
+	}
+	if s := query.GetRangeValueStart(); len(s) > 0 {
+		if k := rowKey(query.GetHashValue(), s); bytes.Compare(k, start) > 0 {
+			start = k
+		}
+	}
+	return prefix, start
+}
+
+// scan reads up to batch rows from start and returns the key to resume from, nil once the prefix is done.
+func scan(cursor *bbolt.Cursor, query *api.QueryIndexRequest, prefix, start []byte, batch int) ([]*api.Row, []byte) {
+	equal := query.GetValueEqual()
+	offset := len(query.GetHashValue()) + len(separator)
+	rows := make([]*api.Row, 0, batch)
+
+	for k, v := cursor.Seek(start); nil != k && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+		if len(equal) > 0 && !bytes.Equal(v, equal) {
+			continue
+		}
+
+		rows = append(rows, &api.Row{
+			RangeValue: append([]byte(nil), k[offset:]...),
+			Value:      append([]byte(nil), v...),
+		})
+		if len(rows) == batch {
+			return rows, append(append([]byte(nil), k...), 0)
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package bolt
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func __new(t *testing.T) (types.IndexClient, func()) {
+	dir, err := ioutil.TempDir("", "bolt")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	log, _ := zap.NewDevelopment()
+	b := New(log, &types.IndexConfig{
+		Driver: "bolt",
+		Url:    dir,
+		Batch:  2,
+	})
+	return b, func() {
+		_ = b.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func __query(t *testing.T, b types.IndexClient, q *api.QueryIndexRequest) []string {
+	var result []string
+	err := b.QueryIndex(context.Background(), q, func(rows []*api.Row) error {
+		if len(rows) > 2 {
+			t.Error("batch overflow", len(rows))
+		}
+		for _, r := range rows {
+			result = append(result, string(r.RangeValue)+"="+string(r.Value))
+		}
+		return nil
+	})
+	if nil != err {
+		t.Error("queryIndex failed", err.Error())
+	}
+	return result
+}
+
+func __equal(t *testing.T, name string, dst []string, src ...string) {
+	if len(dst) != len(src) {
+		t.Errorf("%s: got %v, want %v", name, dst, src)
+		return
+	}
+	for i := range src {
+		if dst[i] != src[i] {
+			t.Errorf("%s: got %v, want %v", name, dst, src)
+			return
+		}
+	}
+}
+
+func TestBolt_Index(t *testing.T) {
+	b, done := __new(t)
+	defer done()
+
+	entries := []*api.IndexEntry{
+		{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte("a1"), Value: []byte("x")},
+		{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte("a2"), Value: []byte("y")},
+		{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte("b1"), Value: []byte("x")},
+		{TableName: "index_1", HashValue: "fake:d10", RangeValue: []byte("a1"), Value: []byte("z")},
+		{TableName: "index_2", HashValue: "fake:d1", RangeValue: []byte("a1"), Value: []byte("w")},
+	}
+	if err := b.WriteIndex(context.Background(), entries); nil != err {
+		t.Fatal("writeIndex failed", err.Error())
+	}
+
+	__equal(t, "hash", __query(t, b, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1"}), "a1=x", "a2=y", "b1=x")
+	__equal(t, "prefix", __query(t, b, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1", RangeValuePrefix: []byte("a")}), "a1=x", "a2=y")
+	__equal(t, "start", __query(t, b, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1", RangeValueStart: []byte("a2")}), "a2=y", "b1=x")
+	__equal(t, "equal", __query(t, b, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1", ValueEqual: []byte("x")}), "a1=x", "b1=x")
+	__equal(t, "table", __query(t, b, &api.QueryIndexRequest{TableName: "index_3", HashValue: "fake:d1"}))
+
+	if err := b.DeleteIndex(context.Background(), entries[:1]); nil != err {
+		t.Fatal("deleteIndex failed", err.Error())
+	}
+	__equal(t, "delete", __query(t, b, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1"}), "a2=y", "b1=x")
+}
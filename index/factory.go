@@ -0,0 +1,39 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package index
+
+import (
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/index/bolt"
+	"github/vlorc/loki-grpc-storage/index/shipper"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+)
+
+var index = map[string]func(*zap.Logger, *types.IndexConfig, types.ObjectClient) (types.IndexClient, error){
+	"bolt":    bolt.Factory,
+	"shipper": shipper.Factory,
+	"empty": func(*zap.Logger, *types.IndexConfig, types.ObjectClient) (types.IndexClient, error) {
+		return empty{}, nil
+	},
+}
+
+func Register(name string, factory func(*zap.Logger, *types.IndexConfig, types.ObjectClient) (types.IndexClient, error)) {
+	index[name] = factory
+}
+
+func New(log *zap.Logger, config *types.IndexConfig, store types.ObjectClient) types.IndexClient {
+	i, err := Factory(log, config, store)
+	if nil != err {
+		panic(err)
+	}
+	return i
+}
+
+func Factory(log *zap.Logger, config *types.IndexConfig, store types.ObjectClient) (types.IndexClient, error) {
+	if factory, ok := index[config.Driver]; ok {
+		return factory(log.With(zap.String("index", config.Driver)), config, store)
+	}
+	return nil, errors.Errorf("can not support index '%s'", config.Driver)
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package shipper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"hash/crc32"
+	"sort"
+)
+
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+var magic = []byte("LGIS\x01")
+
+type record struct {
+	key   []byte
+	value []byte
+	op    byte
+}
+
+type segment struct {
+	name    string
+	records []record
+}
+
+type segmentWriter struct {
+	buf   bytes.Buffer
+	count int
+	tmp   [binary.MaxVarintLen64]byte
+}
+
+func newSegmentWriter() *segmentWriter {
+	w := &segmentWriter{}
+	w.buf.Write(magic)
+	return w
+}
+
+func (w *segmentWriter) append(key, value []byte) {
+	w.uvarint(uint64(len(key)))
+	w.buf.Write(key)
+	w.buf.WriteByte(value[0])
+	w.uvarint(uint64(len(value) - 1))
+	w.buf.Write(value[1:])
+	w.count++
+}
+
+func (w *segmentWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(w.tmp[:], v)
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *segmentWriter) bytes() []byte {
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(w.buf.Bytes()))
+	w.buf.Write(sum[:])
+	return w.buf.Bytes()
+}
+
+func parseSegment(name string, buf []byte) (*segment, error) {
+	if len(buf) < len(magic)+4 || !bytes.Equal(buf[:len(magic)], magic) {
+		return nil, errors.Errorf("invalid segment '%s'", name)
+	}
+	body, sum := buf[:len(buf)-4], binary.BigEndian.Uint32(buf[len(buf)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, errors.Errorf("segment '%s' checksum mismatch", name)
+	}
+
+	seg := &segment{name: name}
+	for body = body[len(magic):]; len(body) > 0; {
+		key, rest, err := readBytes(body)
+		if nil != err || len(rest) < 1 {
+			return nil, errors.Errorf("segment '%s' truncated", name)
+		}
+		op := rest[0]
+		value, rest, err := readBytes(rest[1:])
+		if nil != err {
+			return nil, errors.Errorf("segment '%s' truncated", name)
+		}
+		seg.records = append(seg.records, record{key: key, value: value, op: op})
+		body = rest
+	}
+
+	return seg, nil
+}
+
+func readBytes(buf []byte) ([]byte, []byte, error) {
+	n, i := binary.Uvarint(buf)
+	if i <= 0 || uint64(len(buf)-i) < n {
+		return nil, nil, errors.New("invalid length")
+	}
+	return buf[i : i+int(n)], buf[i+int(n):], nil
+}
+
+func (seg *segment) scan(prefix, start []byte, visit func(record)) {
+	i := sort.Search(len(seg.records), func(i int) bool {
+		return bytes.Compare(seg.records[i].key, start) >= 0
+	})
+	for ; i < len(seg.records) && bytes.HasPrefix(seg.records[i].key, prefix); i++ {
+		visit(seg.records[i])
+	}
+}
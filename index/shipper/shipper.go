@@ -0,0 +1,631 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package shipper
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const separator = "\000"
+
+var (
+	localBucket    = []byte("local")
+	manifestBucket = []byte("manifest")
+)
+
+// Shipper buffers index writes in a local bolt database and periodically seals them
+// into immutable segments uploaded through the object store, each node writes a manifest
+// of its own segments per table and the readers list the manifests of every node.
+type Shipper struct {
+	log    *zap.Logger
+	db     *bbolt.DB
+	store  types.ObjectClient
+	lister types.ObjectLister
+	prefix string
+	cache  string
+	node   string
+	batch  int
+	seal   time.Duration
+	sync   time.Duration
+
+	mtx    sync.RWMutex
+	active uint64
+	sealer sync.Mutex
+
+	lock   sync.Mutex
+	tables map[string]*table
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type table struct {
+	mtx      sync.Mutex
+	synced   time.Time
+	names    []string
+	segments map[string]*segment
+}
+
+type manifest struct {
+	Segments []string `json:"segments"`
+}
+
+var _ types.IndexClient = &Shipper{}
+
+func New(log *zap.Logger, config *types.IndexConfig, store types.ObjectClient) types.IndexClient {
+	s, err := Factory(log, config, store)
+	if nil != err {
+		panic(err)
+	}
+	return s
+}
+
+func Factory(log *zap.Logger, config *types.IndexConfig, store types.ObjectClient) (types.IndexClient, error) {
+	if nil == store {
+		return nil, errors.New("index shipper requires an object store")
+	}
+	lister, err := types.Lister(store)
+	if nil != err {
+		return nil, errors.Wrap(err, "index shipper requires an object store able to list")
+	}
+
+	root, err := filepath.Abs(filepath.Clean(config.Url))
+	if nil != err {
+		return nil, err
+	}
+	if err = os.MkdirAll(root, 0755); nil != err {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(filepath.Join(root, "shipper.db"), 0644, &bbolt.Options{Timeout: 5 * time.Second})
+	if nil != err {
+		return nil, err
+	}
+
+	s := &Shipper{
+		log:    log,
+		db:     db,
+		store:  store,
+		lister: lister,
+		prefix: config.Prefix,
+		node:   config.Node,
+		cache:  filepath.Join(root, "cache"),
+		batch:  config.Batch,
+		seal:   config.Seal,
+		sync:   config.Sync,
+		tables: map[string]*table{},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if s.batch <= 0 {
+		s.batch = 256
+	}
+	if s.seal <= 0 {
+		s.seal = 15 * time.Minute
+	}
+	if "" == s.node {
+		if s.node, err = os.Hostname(); nil != err || "" == s.node {
+			s.node = "localhost"
+		}
+	}
+	if err = s.open(); nil != err {
+		_ = db.Close()
+		return nil, err
+	}
+
+	go s.loop()
+
+	return s, nil
+}
+
+func (s *Shipper) WriteIndex(ctx context.Context, entries []*api.IndexEntry) error {
+	return s.update(entries, opPut)
+}
+
+func (s *Shipper) DeleteIndex(ctx context.Context, entries []*api.IndexEntry) error {
+	return s.update(entries, opDelete)
+}
+
+func (s *Shipper) QueryIndex(ctx context.Context, query *api.QueryIndexRequest, callback func([]*api.Row) error) error {
+	segments, err := s.segments(ctx, query.GetTableName())
+	if nil != err {
+		return err
+	}
+
+	prefix, start := bounds(query)
+	merged := map[string]record{}
+	visit := func(r record) {
+		merged[string(r.key)] = r
+	}
+
+	for _, seg := range segments {
+		seg.scan(prefix, start, visit)
+	}
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(localBucket).ForEach(func(gen, _ []byte) error {
+			if b := tx.Bucket(localBucket).Bucket(gen).Bucket([]byte(query.GetTableName())); nil != b {
+				c := b.Cursor()
+				for k, v := c.Seek(start); nil != k && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+					visit(record{key: append([]byte(nil), k...), value: append([]byte(nil), v[1:]...), op: v[0]})
+				}
+			}
+			return nil
+		})
+	})
+	if nil != err {
+		return err
+	}
+
+	return emit(ctx, query, merged, s.batch, callback)
+}
+
+func (s *Shipper) DeleteTable(ctx context.Context, name string) error {
+	t := s.table(name)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	manifests, err := s.manifests(ctx, name)
+	if nil != err {
+		return err
+	}
+	names, err := s.remote(ctx, manifests)
+	if nil != err {
+		return err
+	}
+	names = merge(append(names, s.local(name)...))
+
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(localBucket).ForEach(func(gen, _ []byte) error {
+			if err := tx.Bucket(localBucket).Bucket(gen).DeleteBucket([]byte(name)); nil != err && bbolt.ErrBucketNotFound != err {
+				return err
+			}
+			return nil
+		}); nil != err {
+			return err
+		}
+		return tx.Bucket(manifestBucket).Delete([]byte(name))
+	})
+	if nil != err {
+		return err
+	}
+
+	for _, n := range names {
+		if err = s.store.DeleteObject(ctx, path.Join(s.prefix, name, n)); nil != err {
+			s.log.Warn("delete segment", zap.String("table", name), zap.String("segment", n), zap.Error(err))
+		}
+	}
+	for _, m := range manifests {
+		if err = s.store.DeleteObject(ctx, m); nil != err {
+			s.log.Warn("delete manifest", zap.String("table", name), zap.String("manifest", m), zap.Error(err))
+		}
+	}
+	if err = os.RemoveAll(filepath.Join(s.cache, filepath.FromSlash(name))); nil != err {
+		s.log.Warn("delete cache", zap.String("table", name), zap.Error(err))
+	}
+
+	t.names = nil
+	t.segments = map[string]*segment{}
+	t.synced = time.Now()
+
+	return nil
+}
+
+func (s *Shipper) Close() error {
+	close(s.stop)
+	<-s.done
+
+	return s.db.Close()
+}
+
+func (s *Shipper) open() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(manifestBucket); nil != err {
+			return err
+		}
+		local, err := tx.CreateBucketIfNotExists(localBucket)
+		if nil != err {
+			return err
+		}
+		if k, _ := local.Cursor().Last(); nil != k {
+			s.active = binary.BigEndian.Uint64(k)
+		}
+		s.active++
+		return nil
+	})
+}
+
+func (s *Shipper) update(entries []*api.IndexEntry, op byte) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		gen, err := tx.Bucket(localBucket).CreateBucketIfNotExists(generation(s.active))
+		if nil != err {
+			return err
+		}
+		for _, e := range entries {
+			b, err := gen.CreateBucketIfNotExists([]byte(e.GetTableName()))
+			if nil != err {
+				return err
+			}
+			value := append([]byte{op}, e.GetValue()...)
+			if err = b.Put(rowKey(e.GetHashValue(), e.GetRangeValue()), value); nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Shipper) loop() {
+	defer close(s.done)
+
+	s.flush(false)
+
+	ticker := time.NewTicker(s.seal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush(true)
+		case <-s.stop:
+			s.flush(true)
+			return
+		}
+	}
+}
+
+func (s *Shipper) flush(rotate bool) {
+	s.sealer.Lock()
+	defer s.sealer.Unlock()
+
+	if rotate {
+		s.mtx.Lock()
+		s.active++
+		s.mtx.Unlock()
+	}
+
+	s.mtx.RLock()
+	active := generation(s.active)
+	s.mtx.RUnlock()
+
+	var gens [][]byte
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(localBucket).ForEach(func(k, _ []byte) error {
+			if bytes.Compare(k, active) < 0 {
+				gens = append(gens, append([]byte(nil), k...))
+			}
+			return nil
+		})
+	})
+
+	for _, gen := range gens {
+		if err := s.sealGeneration(gen); nil != err {
+			s.log.Error("seal generation", zap.Uint64("generation", binary.BigEndian.Uint64(gen)), zap.Error(err))
+			return
+		}
+	}
+}
+
+func (s *Shipper) sealGeneration(gen []byte) error {
+	segments := map[string][]byte{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(localBucket).Bucket(gen).ForEach(func(name, _ []byte) error {
+			w := newSegmentWriter()
+			if err := tx.Bucket(localBucket).Bucket(gen).Bucket(name).ForEach(func(k, v []byte) error {
+				w.append(k, v)
+				return nil
+			}); nil != err {
+				return err
+			}
+			if w.count > 0 {
+				segments[string(name)] = w.bytes()
+			}
+			return nil
+		})
+	})
+	if nil != err {
+		return err
+	}
+
+	now := time.Now()
+	for name, buf := range segments {
+		if err := s.ship(name, segmentName(now, s.seal, s.node), buf); nil != err {
+			return err
+		}
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(localBucket).DeleteBucket(gen)
+	})
+}
+
+func (s *Shipper) ship(name, segName string, buf []byte) error {
+	ctx := context.Background()
+	now := time.Now()
+
+	seg, err := parseSegment(segName, buf)
+	if nil != err {
+		return err
+	}
+	if err = s.store.PutObject(ctx, path.Join(s.prefix, name, segName), buf); nil != err {
+		return err
+	}
+
+	t := s.table(name)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	own, err := s.read(ctx, s.manifest(name))
+	if nil != err {
+		return err
+	}
+	own = merge(append(append(own, s.local(name)...), segName))
+	if err = s.saveLocal(name, own); nil != err {
+		return err
+	}
+	if err = s.saveRemote(ctx, name, own); nil != err {
+		return err
+	}
+
+	t.names = merge(append(t.names, own...))
+	t.segments[segName] = seg
+	t.synced = now
+
+	s.log.Info("seal segment", zap.String("table", name), zap.String("segment", segName), zap.Int("length", len(buf)), zap.Duration("latency", time.Now().Sub(now)))
+
+	return nil
+}
+
+func (s *Shipper) table(name string) *table {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, ok := s.tables[name]
+	if !ok {
+		t = &table{segments: map[string]*segment{}}
+		s.tables[name] = t
+	}
+	return t
+}
+
+func (s *Shipper) segments(ctx context.Context, name string) ([]*segment, error) {
+	t := s.table(name)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if time.Now().Sub(t.synced) >= s.sync {
+		manifests, err := s.manifests(ctx, name)
+		if nil != err {
+			return nil, err
+		}
+		names, err := s.remote(ctx, manifests)
+		if nil != err {
+			return nil, err
+		}
+		t.names = merge(append(names, s.local(name)...))
+		t.synced = time.Now()
+	}
+
+	result := make([]*segment, 0, len(t.names))
+	for _, n := range t.names {
+		seg, ok := t.segments[n]
+		if !ok {
+			var err error
+			if seg, err = s.load(ctx, name, n); nil != err {
+				return nil, err
+			}
+			t.segments[n] = seg
+		}
+		result = append(result, seg)
+	}
+
+	return result, nil
+}
+
+func (s *Shipper) load(ctx context.Context, name, segName string) (*segment, error) {
+	p := filepath.Join(s.cache, filepath.FromSlash(name), filepath.FromSlash(segName))
+	if buf, err := utils.ReadFile(p); nil == err {
+		if seg, err := parseSegment(segName, buf); nil == err {
+			return seg, nil
+		}
+		s.log.Warn("invalid cached segment", zap.String("path", p))
+	}
+
+	buf, err := s.store.GetObject(ctx, path.Join(s.prefix, name, segName))
+	if nil != err {
+		return nil, err
+	}
+	seg, err := parseSegment(segName, buf)
+	if nil != err {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(p), 0755); nil == err {
+		err = utils.WriteFile(p, buf)
+	}
+	if nil != err {
+		s.log.Warn("cache segment", zap.String("path", p), zap.Error(err))
+	}
+
+	return seg, nil
+}
+
+// manifests lists the manifests of every node of a table, along with the one shared by the nodes
+// before they had their own.
+func (s *Shipper) manifests(ctx context.Context, name string) ([]string, error) {
+	var keys []string
+	err := types.WalkObjects(ctx, s.lister, path.Join(s.prefix, name, "manifest"), s.batch, func(o types.ObjectInfo) error {
+		keys = append(keys, o.Key)
+		return nil
+	})
+	if nil != err {
+		s.log.Warn("list manifests", zap.String("table", name), zap.Error(err))
+		return nil, err
+	}
+	return keys, nil
+}
+
+// remote merges the segments of the manifests, a manifest which could not be read fails
+// the whole table rather than hiding the segments it holds.
+func (s *Shipper) remote(ctx context.Context, manifests []string) ([]string, error) {
+	var names []string
+	for _, m := range manifests {
+		segments, err := s.read(ctx, m)
+		if nil != err {
+			return nil, err
+		}
+		names = append(names, segments...)
+	}
+	return merge(names), nil
+}
+
+// read reads a manifest, only a missing manifest is empty.
+func (s *Shipper) read(ctx context.Context, key string) ([]string, error) {
+	buf, err := s.store.GetObject(ctx, key)
+	if nil != err {
+		if types.IsNotFound(err) {
+			return nil, nil
+		}
+		s.log.Warn("load manifest", zap.String("manifest", key), zap.Error(err))
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, nil
+	}
+
+	m := &manifest{}
+	if err = json.Unmarshal(buf, m); nil != err {
+		s.log.Warn("invalid manifest", zap.String("manifest", key), zap.Error(err))
+		return nil, errors.Wrapf(err, "invalid manifest '%s'", key)
+	}
+	return m.Segments, nil
+}
+
+// manifest is the manifest of the segments of a table shipped by this node, written by no other node.
+func (s *Shipper) manifest(name string) string {
+	return path.Join(s.prefix, name, "manifest-"+s.node)
+}
+
+func (s *Shipper) saveRemote(ctx context.Context, name string, names []string) error {
+	buf, err := json.Marshal(&manifest{Segments: names})
+	if nil != err {
+		return err
+	}
+	return s.store.PutObject(ctx, s.manifest(name), buf)
+}
+
+func (s *Shipper) local(name string) (names []string) {
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		if buf := tx.Bucket(manifestBucket).Get([]byte(name)); nil != buf {
+			return json.Unmarshal(buf, &names)
+		}
+		return nil
+	})
+	return names
+}
+
+func (s *Shipper) saveLocal(name string, names []string) error {
+	buf, err := json.Marshal(names)
+	if nil != err {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(manifestBucket).Put([]byte(name), buf)
+	})
+}
+
+func emit(ctx context.Context, query *api.QueryIndexRequest, merged map[string]record, batch int, callback func([]*api.Row) error) error {
+	keys := make([]string, 0, len(merged))
+	for k, r := range merged {
+		if opPut == r.op && (len(query.GetValueEqual()) == 0 || bytes.Equal(r.value, query.GetValueEqual())) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	offset := len(query.GetHashValue()) + len(separator)
+	rows := make([]*api.Row, 0, batch)
+	for _, k := range keys {
+		rows = append(rows, &api.Row{RangeValue: []byte(k[offset:]), Value: merged[k].value})
+		if len(rows) < batch {
+			continue
+		}
+		if err := ctx.Err(); nil != err {
+			return err
+		}
+		if err := callback(rows); nil != err {
+			return err
+		}
+		rows = make([]*api.Row, 0, batch)
+	}
+	if len(rows) > 0 {
+		return callback(rows)
+	}
+
+	return nil
+}
+
+func bounds(query *api.QueryIndexRequest) ([]byte, []byte) {
+	prefix := rowKey(query.GetHashValue(), nil)
+	start := prefix
+
+	if p := query.GetRangeValuePrefix(); len(p) > 0 {
+		prefix = rowKey(query.GetHashValue(), p)
+		start = prefix
+	}
+	if v := query.GetRangeValueStart(); len(v) > 0 {
+		if k := rowKey(query.GetHashValue(), v); bytes.Compare(k, start) > 0 {
+			start = k
+		}
+	}
+
+	return prefix, start
+}
+
+func merge(names []string) []string {
+	sort.Strings(names)
+	result := names[:0]
+	for i, n := range names {
+		if 0 == i || names[i-1] != n {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func rowKey(hash string, rangeValue []byte) []byte {
+	k := make([]byte, 0, len(hash)+len(separator)+len(rangeValue))
+	k = append(k, hash...)
+	k = append(k, separator...)
+	k = append(k, rangeValue...)
+	return k
+}
+
+func generation(v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return b[:]
+}
+
+func segmentName(now time.Time, period time.Duration, node string) string {
+	return fmt.Sprintf("%010d/%019d-%s", now.Truncate(period).Unix(), now.UnixNano(), node)
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package shipper
+
+import (
+	"context"
+	"fmt"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func __new(t *testing.T, store types.ObjectClient, node string) (*Shipper, func()) {
+	dir, err := ioutil.TempDir("", "shipper")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	log, _ := zap.NewDevelopment()
+	s := New(log, &types.IndexConfig{
+		Driver: "shipper",
+		Url:    dir,
+		Prefix: "index",
+		Batch:  2,
+		Seal:   time.Hour,
+		Node:   node,
+	}, store).(*Shipper)
+	return s, func() {
+		_ = s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func __query(t *testing.T, s *Shipper, q *api.QueryIndexRequest) []string {
+	var result []string
+	if err := s.QueryIndex(context.Background(), q, func(rows []*api.Row) error {
+		for _, r := range rows {
+			result = append(result, string(r.RangeValue)+"="+string(r.Value))
+		}
+		return nil
+	}); nil != err {
+		t.Error("queryIndex failed", err.Error())
+	}
+	return result
+}
+
+func __equal(t *testing.T, name string, dst []string, src ...string) {
+	if len(dst) != len(src) {
+		t.Errorf("%s: got %v, want %v", name, dst, src)
+		return
+	}
+	for i := range src {
+		if dst[i] != src[i] {
+			t.Errorf("%s: got %v, want %v", name, dst, src)
+			return
+		}
+	}
+}
+
+func TestShipper_Index(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	s, done := __new(t, store, "a")
+	defer done()
+
+	entries := []*api.IndexEntry{
+		{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte("a1"), Value: []byte("x")},
+		{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte("a2"), Value: []byte("y")},
+		{TableName: "index_1", HashValue: "fake:d10", RangeValue: []byte("a1"), Value: []byte("z")},
+	}
+	if err := s.WriteIndex(context.Background(), entries); nil != err {
+		t.Fatal("writeIndex failed", err.Error())
+	}
+	s.flush(true)
+
+	if err := s.WriteIndex(context.Background(), []*api.IndexEntry{
+		{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte("b1"), Value: []byte("x")},
+	}); nil != err {
+		t.Fatal("writeIndex failed", err.Error())
+	}
+	if err := s.DeleteIndex(context.Background(), entries[1:2]); nil != err {
+		t.Fatal("deleteIndex failed", err.Error())
+	}
+
+	__equal(t, "merge", __query(t, s, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1"}), "a1=x", "b1=x")
+	__equal(t, "equal", __query(t, s, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d10", ValueEqual: []byte("z")}), "a1=z")
+	s.flush(true)
+
+	other, closed := __new(t, store, "b")
+	defer closed()
+	__equal(t, "remote", __query(t, other, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1", RangeValueStart: []byte("a2")}), "b1=x")
+}
+
+func TestShipper_Manifest(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	s, done := __new(t, store, "a")
+	defer done()
+
+	broken := []byte("{\"segments\":")
+	store.PutObject(context.Background(), "index/index_1/manifest", broken)
+
+	if err := s.WriteIndex(context.Background(), []*api.IndexEntry{
+		{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte("a1"), Value: []byte("x")},
+	}); nil != err {
+		t.Fatal("writeIndex failed", err.Error())
+	}
+	s.flush(true)
+
+	if buf, _ := store.GetObject(context.Background(), "index/index_1/manifest"); string(buf) != string(broken) {
+		t.Error("unreadable manifest overwritten", string(buf))
+	}
+	if err := s.QueryIndex(context.Background(), &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1"}, func([]*api.Row) error {
+		return nil
+	}); nil == err {
+		t.Error("unreadable manifest ignored")
+	}
+}
+
+func TestShipper_Nodes(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	a, done := __new(t, store, "a")
+	defer done()
+	b, closed := __new(t, store, "b")
+	defer closed()
+
+	for i := 0; i < 3; i++ {
+		var wg sync.WaitGroup
+		for _, s := range []*Shipper{a, b} {
+			if err := s.WriteIndex(context.Background(), []*api.IndexEntry{
+				{TableName: "index_1", HashValue: "fake:d1", RangeValue: []byte(fmt.Sprintf("%s%d", s.node, i)), Value: []byte("x")},
+			}); nil != err {
+				t.Fatal("writeIndex failed", err.Error())
+			}
+			wg.Add(1)
+			go func(s *Shipper) {
+				defer wg.Done()
+				s.flush(true)
+			}(s)
+		}
+		wg.Wait()
+	}
+
+	reader, finish := __new(t, store, "c")
+	defer finish()
+	__equal(t, "nodes", __query(t, reader, &api.QueryIndexRequest{TableName: "index_1", HashValue: "fake:d1"}), "a0=x", "a1=x", "a2=x", "b0=x", "b1=x", "b2=x")
+
+	if err := reader.DeleteTable(context.Background(), "index_1"); nil != err {
+		t.Fatal("deleteTable failed", err.Error())
+	}
+	if objects, _, _ := store.(types.ObjectLister).ListObjects(context.Background(), "index/", "", 0); len(objects) != 0 {
+		t.Error("table objects kept", objects)
+	}
+}
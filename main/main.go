@@ -4,9 +4,13 @@
 package main
 
 import (
+	"context"
+	"github/vlorc/loki-grpc-storage/router"
 	"github/vlorc/loki-grpc-storage/server"
 	"github/vlorc/loki-grpc-storage/types"
 	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"os"
 )
 
 func main() {
@@ -14,6 +18,15 @@ func main() {
 
 	utils.Flag(conf)
 
+	if conf.Store.Rewrap {
+		log := types.NewLog(&conf.Log)
+		if err := router.Rewrap(context.Background(), log, &conf.Store); nil != err {
+			log.Error("rewrap failed", zap.Error(err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	srv := server.NewServer(conf)
 
 	utils.OnExit(srv)
@@ -0,0 +1,217 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package pool
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+type Priority int
+
+const (
+	// Normal serves reads and writes.
+	Normal Priority = iota
+	// Low serves deletes, it runs when no normal work is queued or once normal work was served share times in a row.
+	Low
+	levels
+)
+
+// share is the most normal work served in a row while low work is queued, so deletes are never starved.
+const share = 8
+
+var ErrClosed = errors.New("pool closed")
+
+type task struct {
+	ctx     context.Context
+	tenant  string
+	run     func(error)
+	started bool
+	dropped bool
+}
+
+// Pool runs driver calls on a fixed number of workers shared by every request,
+// queued work is served by priority and round robin between tenants.
+type Pool struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	queues [levels]*fair
+	streak int
+	closed bool
+	group  sync.WaitGroup
+}
+
+func New(workers int) *Pool {
+	p := &Pool{}
+	p.cond = sync.NewCond(&p.lock)
+	for i := range p.queues {
+		p.queues[i] = &fair{tenants: map[string][]*task{}}
+	}
+
+	p.group.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// Go queues fn, it is called with nil on a worker, or with the error of the context
+// when the context is done before a worker picked it up.
+func (p *Pool) Go(ctx context.Context, priority Priority, tenant string, fn func(error)) {
+	if _, err := p.push(ctx, priority, tenant, fn); nil != err {
+		fn(err)
+	}
+}
+
+// Do runs fn on a worker and waits for it, it returns early when the context is done before fn started.
+func (p *Pool) Do(ctx context.Context, priority Priority, tenant string, fn func()) error {
+	done := make(chan error, 1)
+	t, err := p.push(ctx, priority, tenant, func(err error) {
+		if nil == err {
+			fn()
+		}
+		done <- err
+	})
+	if nil != err {
+		return err
+	}
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	p.lock.Lock()
+	if !t.started {
+		t.dropped = true
+		p.lock.Unlock()
+		return ctx.Err()
+	}
+	p.lock.Unlock()
+
+	return <-done
+}
+
+// Close drops the queued work and waits for the running one.
+func (p *Pool) Close() {
+	p.lock.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.lock.Unlock()
+
+	p.group.Wait()
+}
+
+func (p *Pool) push(ctx context.Context, priority Priority, tenant string, fn func(error)) (*task, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+	if priority < 0 || priority >= levels {
+		priority = Low
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return nil, ErrClosed
+	}
+
+	t := &task{ctx: ctx, tenant: tenant, run: fn}
+	p.queues[priority].push(t)
+	p.cond.Signal()
+
+	return t, nil
+}
+
+func (p *Pool) pop() *task {
+	if p.streak >= share {
+		if t := p.queues[Low].pop(); nil != t {
+			p.streak = 0
+			return t
+		}
+	}
+	for i, q := range p.queues {
+		if t := q.pop(); nil != t {
+			if p.streak++; Low == Priority(i) {
+				p.streak = 0
+			}
+			return t
+		}
+	}
+	return nil
+}
+
+func (p *Pool) work() {
+	defer p.group.Done()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for {
+		t := p.pop()
+		if nil == t {
+			if p.closed {
+				return
+			}
+			p.cond.Wait()
+			continue
+		}
+		if t.dropped {
+			continue
+		}
+
+		err := t.ctx.Err()
+		if nil == err && p.closed {
+			err = ErrClosed
+		}
+		t.started = true
+
+		p.lock.Unlock()
+		t.run(err)
+		p.lock.Lock()
+	}
+}
+
+// fair is a queue per tenant served round robin.
+type fair struct {
+	tenants map[string][]*task
+	ring    []string
+	next    int
+}
+
+func (f *fair) push(t *task) {
+	q, ok := f.tenants[t.tenant]
+	if !ok {
+		f.ring = append(f.ring, t.tenant)
+	}
+	f.tenants[t.tenant] = append(q, t)
+}
+
+func (f *fair) pop() *task {
+	if len(f.ring) == 0 {
+		return nil
+	}
+	if f.next >= len(f.ring) {
+		f.next = 0
+	}
+
+	name := f.ring[f.next]
+	q := f.tenants[name]
+	t := q[0]
+	q[0] = nil
+
+	if len(q) == 1 {
+		delete(f.tenants, name)
+		f.ring = append(f.ring[:f.next], f.ring[f.next+1:]...)
+	} else {
+		f.tenants[name] = q[1:]
+		f.next++
+	}
+
+	return t
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package pool
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPool_Fair(t *testing.T) {
+	p := New(1)
+	defer p.Close()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.Go(context.Background(), Normal, "", func(error) {
+		close(started)
+		<-block
+	})
+	<-started
+
+	var order []string
+	var lock sync.Mutex
+	g := &sync.WaitGroup{}
+	run := func(ctx context.Context, priority Priority, tenant, name string) {
+		g.Add(1)
+		p.Go(ctx, priority, tenant, func(err error) {
+			defer g.Done()
+			if nil != err {
+				name = "-" + name
+			}
+			lock.Lock()
+			order = append(order, name)
+			lock.Unlock()
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run(context.Background(), Low, "a", "delete")
+	run(context.Background(), Normal, "a", "a1")
+	run(context.Background(), Normal, "a", "a2")
+	run(ctx, Normal, "c", "c1")
+	run(context.Background(), Normal, "a", "a3")
+	run(context.Background(), Normal, "b", "b1")
+	cancel()
+	close(block)
+	g.Wait()
+
+	if s := strings.Join(order, ","); s != "a1,-c1,b1,a2,a3,delete" {
+		t.Error("order failed", s)
+	}
+}
+
+func TestPool_Share(t *testing.T) {
+	p := New(1)
+	defer p.Close()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.Go(context.Background(), Low, "", func(error) {
+		close(started)
+		<-block
+	})
+	<-started
+
+	var order []string
+	g := &sync.WaitGroup{}
+	run := func(priority Priority, name string) {
+		g.Add(1)
+		p.Go(context.Background(), priority, "", func(error) {
+			defer g.Done()
+			order = append(order, name)
+		})
+	}
+	run(Low, "delete")
+	for i := 0; i < 2*share; i++ {
+		run(Normal, "get")
+	}
+	close(block)
+	g.Wait()
+
+	if i := strings.Index(strings.Join(order, ","), "delete"); i != share*len("get,") {
+		t.Error("low work starved", order)
+	}
+}
+
+func TestPool_Do(t *testing.T) {
+	p := New(1)
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	go p.Do(context.Background(), Normal, "", func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran := false
+	if err := p.Do(ctx, Normal, "", func() { ran = true }); context.Canceled != err || ran {
+		t.Error("cancel failed", err, ran)
+	}
+
+	close(block)
+	p.Close()
+	if err := p.Do(context.Background(), Normal, "", func() {}); ErrClosed != err {
+		t.Error("close failed", err)
+	}
+}
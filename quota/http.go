@@ -0,0 +1,31 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package quota
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type report struct {
+	Usage  Usage  `json:"usage"`
+	Limits Limits `json:"limits"`
+}
+
+// ServeHTTP reports the usage and limits of every tenant, or of the tenant of the query.
+func (q *Quota) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	usage := q.Usage()
+	reports := map[string]report{}
+
+	if tenant := r.URL.Query().Get("tenant"); "" != tenant {
+		reports[tenant] = report{Usage: usage[tenant], Limits: q.Limits(tenant)}
+	} else {
+		for tenant, u := range usage {
+			reports[tenant] = report{Usage: u, Limits: q.Limits(tenant)}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(reports)
+}
@@ -0,0 +1,392 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const pageSize = 1000
+
+// Limits of a tenant, zero is unlimited.
+type Limits struct {
+	Bytes  int64 `json:"bytes"`
+	Chunks int64 `json:"chunks"`
+	Rate   int   `json:"rate"`
+}
+
+type Usage struct {
+	Bytes  int64 `json:"bytes"`
+	Chunks int64 `json:"chunks"`
+}
+
+// Quota accounts the chunks stored per tenant and rejects the puts exceeding their limits.
+// The usage is rebuilt by listing the store, or kept in a state object when the store can not list.
+// Both count the bytes stored, after compression and encryption, as a listing reports them.
+type Quota struct {
+	log      *zap.Logger
+	store    types.ObjectClient
+	defaults Limits
+	tenants  map[string]Limits
+	interval time.Duration
+	state    string
+	lock     sync.Mutex
+	usage    map[string]*Usage
+	pending  map[string]*Usage
+	limiters map[string]*rate.Limiter
+	recent   map[string]int64
+	previous map[string]int64
+}
+
+func New(log *zap.Logger, conf *types.QuotaConfig, store types.ObjectClient) (*Quota, error) {
+	q := &Quota{
+		log:      log.With(zap.String("quota", "tenant")),
+		store:    store,
+		defaults: Limits{Bytes: conf.Bytes, Chunks: conf.Chunks, Rate: conf.Rate},
+		tenants:  map[string]Limits{},
+		interval: conf.Interval,
+		state:    conf.State,
+		usage:    map[string]*Usage{},
+		limiters: map[string]*rate.Limiter{},
+		recent:   map[string]int64{},
+		previous: map[string]int64{},
+	}
+	if "" != conf.Tenants {
+		buf, err := ioutil.ReadFile(conf.Tenants)
+		if nil != err {
+			return nil, err
+		}
+		if err = json.Unmarshal(buf, &q.tenants); nil != err {
+			return nil, errors.Wrapf(err, "invalid quota file '%s'", conf.Tenants)
+		}
+	}
+	if q.interval <= 0 {
+		q.interval = time.Hour
+	}
+
+	return q, nil
+}
+
+// Enabled reports whether any limit is configured.
+func Enabled(conf *types.QuotaConfig) bool {
+	return conf.Bytes > 0 || conf.Chunks > 0 || conf.Rate > 0 || "" != conf.Tenants
+}
+
+// Client returns the store accounting and limiting the puts of chunks.
+func (q *Quota) Client() types.ObjectClient {
+	return types.Decorate(q, q.store)
+}
+
+func (q *Quota) Run(ctx context.Context) {
+	if _, err := types.Lister(q.store); nil != err {
+		q.runState(ctx)
+		return
+	}
+
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.Scan(ctx); nil != err && ctx.Err() == nil {
+			q.log.Error("scan usage", zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+			q.rotate()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *Quota) runState(ctx context.Context) {
+	if err := q.load(ctx); nil != err {
+		q.log.Warn("load usage", zap.String("state", q.state), zap.Error(err))
+	}
+
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err := q.save(context.Background()); nil != err {
+				q.log.Error("save usage", zap.String("state", q.state), zap.Error(err))
+			}
+			return
+		}
+		q.rotate()
+		if err := q.save(ctx); nil != err {
+			q.log.Error("save usage", zap.String("state", q.state), zap.Error(err))
+		}
+	}
+}
+
+// Scan rebuilds the usage from a listing of the store, the puts and deletes made
+// while scanning are applied on top of it.
+func (q *Quota) Scan(ctx context.Context) error {
+	lister, err := types.Lister(q.store)
+	if nil != err {
+		return err
+	}
+
+	q.lock.Lock()
+	q.pending = map[string]*Usage{}
+	q.lock.Unlock()
+
+	begin := time.Now()
+	usage := map[string]*Usage{}
+	err = types.WalkObjects(ctx, lister, "", pageSize, func(o types.ObjectInfo) error {
+		if tenant := tenantOf(o.Key); "" != tenant {
+			u := get(usage, tenant)
+			u.Bytes += o.Size
+			u.Chunks++
+		}
+		return nil
+	})
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	pending := q.pending
+	q.pending = nil
+	if nil != err {
+		return err
+	}
+	for tenant, p := range pending {
+		u := get(usage, tenant)
+		u.Bytes += p.Bytes
+		u.Chunks += p.Chunks
+	}
+	q.usage = usage
+	q.log.Info("scan usage", zap.Int("tenants", len(usage)), zap.Duration("latency", time.Now().Sub(begin)))
+
+	return nil
+}
+
+// Usage returns a copy of the usage of every tenant.
+func (q *Quota) Usage() map[string]Usage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	usage := make(map[string]Usage, len(q.usage))
+	for tenant, u := range q.usage {
+		usage[tenant] = *u
+	}
+	return usage
+}
+
+func (q *Quota) Limits(tenant string) Limits {
+	if l, ok := q.tenants[tenant]; ok {
+		return l
+	}
+	return q.defaults
+}
+
+func (q *Quota) PutObject(ctx context.Context, key string, object []byte) error {
+	tenant := tenantOf(key)
+	if "" == tenant {
+		return q.store.PutObject(ctx, key, object)
+	}
+
+	// the limits are checked against the bytes put, the bytes stored are accounted once known
+	limits := q.Limits(tenant)
+	size, exists := q.written(key)
+	delta := Usage{Bytes: int64(len(object)) - size, Chunks: 1}
+	if exists {
+		delta.Chunks = 0
+	}
+	if err := q.reserve(tenant, key, limits, delta, len(object)); nil != err {
+		return err
+	}
+
+	stored := int64(len(object))
+	if err := q.store.PutObject(utils.WithStored(ctx, &stored), key, object); nil != err {
+		q.add(tenant, Usage{Bytes: -delta.Bytes, Chunks: -delta.Chunks})
+		return err
+	}
+
+	q.lock.Lock()
+	q.apply(tenant, Usage{Bytes: stored - int64(len(object))})
+	q.recent[key] = stored
+	q.lock.Unlock()
+
+	return nil
+}
+
+func (q *Quota) GetObject(ctx context.Context, key string) ([]byte, error) {
+	return q.store.GetObject(ctx, key)
+}
+
+func (q *Quota) DeleteObject(ctx context.Context, key string) error {
+	tenant := tenantOf(key)
+	if "" == tenant {
+		return q.store.DeleteObject(ctx, key)
+	}
+
+	size, exists := q.size(ctx, key)
+	err := q.store.DeleteObject(ctx, key)
+	if nil == err && exists {
+		q.lock.Lock()
+		q.apply(tenant, Usage{Bytes: -size, Chunks: -1})
+		delete(q.recent, key)
+		delete(q.previous, key)
+		q.lock.Unlock()
+	}
+	return err
+}
+
+func (q *Quota) Ping() error {
+	return q.store.Ping()
+}
+
+func (q *Quota) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	return q.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+}
+
+func (q *Quota) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	return q.store.(types.ObjectStater).Stat(ctx, key)
+}
+
+// written returns the bytes stored for a key put lately, loki writes each chunk once per replica
+// within a short while so those overwrites are not counted twice. Older overwrites are counted
+// as new chunks until the next scan.
+func (q *Quota) written(key string) (int64, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if size, ok := q.recent[key]; ok {
+		return size, true
+	}
+	size, ok := q.previous[key]
+	return size, ok
+}
+
+// rotate forgets the keys put more than an interval ago.
+func (q *Quota) rotate() {
+	q.lock.Lock()
+	q.previous, q.recent = q.recent, map[string]int64{}
+	q.lock.Unlock()
+}
+
+// size returns the bytes stored for an existing object, known from a recent put or from stat.
+func (q *Quota) size(ctx context.Context, key string) (int64, bool) {
+	if size, ok := q.written(key); ok {
+		return size, true
+	}
+	stater, err := types.Stater(q.store)
+	if nil != err {
+		return 0, false
+	}
+	info, err := stater.Stat(ctx, key)
+	if nil != err {
+		return 0, false
+	}
+	return info.Size, true
+}
+
+func (q *Quota) reserve(tenant, key string, limits Limits, delta Usage, n int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	u := get(q.usage, tenant)
+	if limits.Bytes > 0 && delta.Bytes > 0 && u.Bytes+delta.Bytes > limits.Bytes {
+		return types.NewError(types.KindQuota, key, errors.Errorf("tenant '%s' exceeds %d stored bytes", tenant, limits.Bytes))
+	}
+	if limits.Chunks > 0 && delta.Chunks > 0 && u.Chunks+delta.Chunks > limits.Chunks {
+		return types.NewError(types.KindQuota, key, errors.Errorf("tenant '%s' exceeds %d chunks", tenant, limits.Chunks))
+	}
+	if limits.Rate > 0 {
+		l, ok := q.limiters[tenant]
+		if !ok {
+			l = rate.NewLimiter(rate.Limit(limits.Rate), limits.Rate)
+			q.limiters[tenant] = l
+		}
+		if n > limits.Rate {
+			n = limits.Rate
+		}
+		if !l.AllowN(time.Now(), n) {
+			return types.NewError(types.KindThrottled, key, errors.Errorf("tenant '%s' exceeds %d bytes/s", tenant, limits.Rate))
+		}
+	}
+
+	q.apply(tenant, delta)
+	return nil
+}
+
+func (q *Quota) add(tenant string, delta Usage) {
+	q.lock.Lock()
+	q.apply(tenant, delta)
+	q.lock.Unlock()
+}
+
+func (q *Quota) apply(tenant string, delta Usage) {
+	u := get(q.usage, tenant)
+	u.Bytes += delta.Bytes
+	u.Chunks += delta.Chunks
+	if nil != q.pending {
+		p := get(q.pending, tenant)
+		p.Bytes += delta.Bytes
+		p.Chunks += delta.Chunks
+	}
+}
+
+func (q *Quota) load(ctx context.Context) error {
+	buf, err := q.store.GetObject(ctx, q.state)
+	if nil != err {
+		if types.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	usage := map[string]*Usage{}
+	if err = json.Unmarshal(buf, &usage); nil != err {
+		return err
+	}
+
+	q.lock.Lock()
+	for tenant, u := range usage {
+		p := get(q.usage, tenant)
+		p.Bytes += u.Bytes
+		p.Chunks += u.Chunks
+	}
+	q.lock.Unlock()
+
+	return nil
+}
+
+func (q *Quota) save(ctx context.Context) error {
+	buf, err := json.Marshal(q.Usage())
+	if nil != err {
+		return err
+	}
+	return q.store.PutObject(ctx, q.state, buf)
+}
+
+func get(usage map[string]*Usage, tenant string) *Usage {
+	u, ok := usage[tenant]
+	if !ok {
+		u = &Usage{}
+		usage[tenant] = u
+	}
+	return u
+}
+
+func tenantOf(key string) string {
+	if info, err := types.ParseCheckId(utils.ParseKey(key)); nil == err {
+		return info.UserID
+	}
+	return ""
+}
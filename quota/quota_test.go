@@ -0,0 +1,123 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"github/vlorc/loki-grpc-storage/driver/compress"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"testing"
+)
+
+var __ids = []string{
+	"fake/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60",
+	"fake/a70ecbaeaa65a26b_17ab9b3875f_17ab9b3889b_d8c9fe60",
+	"fake/a70ecbaeaa65a26c_17ab9b3875f_17ab9b3889b_d8c9fe60",
+}
+
+func TestQuota_Put(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	q, err := New(log, &types.QuotaConfig{Bytes: 10, Chunks: 2}, store)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	c := q.Client()
+
+	for i := 0; i < 3; i++ {
+		if err := c.PutObject(context.Background(), __ids[0], []byte("cccc")); nil != err {
+			t.Fatal("putObject replica failed", err.Error())
+		}
+	}
+	if err := c.PutObject(context.Background(), __ids[1], []byte("cccccccc")); types.KindQuota != types.KindOf(err) {
+		t.Error("bytes quota failed", err)
+	}
+	if err := c.PutObject(context.Background(), __ids[1], []byte("cccc")); nil != err {
+		t.Fatal("putObject failed", err.Error())
+	}
+	if err := c.PutObject(context.Background(), __ids[2], []byte("c")); types.KindQuota != types.KindOf(err) {
+		t.Error("chunks quota failed", err)
+	}
+	if err := c.PutObject(context.Background(), "tables.json", make([]byte, 100)); nil != err {
+		t.Error("non chunk object limited", err)
+	}
+	if u := q.Usage()["fake"]; u.Bytes != 8 || u.Chunks != 2 {
+		t.Error("usage failed", u)
+	}
+
+	if err := c.DeleteObject(context.Background(), __ids[0]); nil != err {
+		t.Fatal("deleteObject failed", err.Error())
+	}
+	if err := c.PutObject(context.Background(), __ids[2], []byte("c")); nil != err {
+		t.Error("put after delete failed", err)
+	}
+
+	if err := q.Scan(context.Background()); nil != err {
+		t.Fatal("scan failed", err.Error())
+	}
+	if u := q.Usage()["fake"]; u.Bytes != 5 || u.Chunks != 2 {
+		t.Error("scan usage failed", u)
+	}
+
+	w := httptest.NewRecorder()
+	q.ServeHTTP(w, httptest.NewRequest("GET", "/quota?tenant=fake", nil))
+	reports := map[string]report{}
+	if err := json.Unmarshal(w.Body.Bytes(), &reports); nil != err || reports["fake"].Limits.Bytes != 10 || reports["fake"].Usage.Chunks != 2 {
+		t.Error("serveHTTP failed", w.Body.String(), err)
+	}
+}
+
+func TestQuota_Stored(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store, err := compress.Wrap(memory.New(log, &types.StoreConfig{Driver: "memory"}), "gzip")
+	if nil != err {
+		t.Fatal("wrap failed", err.Error())
+	}
+	q, err := New(log, &types.QuotaConfig{Bytes: 1 << 20}, store)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	c := q.Client()
+
+	for i := 0; i < 3; i++ {
+		if err := c.PutObject(context.Background(), __ids[0], make([]byte, 4096)); nil != err {
+			t.Fatal("putObject failed", err.Error())
+		}
+	}
+	put := q.Usage()["fake"]
+	if put.Chunks != 1 || put.Bytes <= 0 || put.Bytes >= 4096 {
+		t.Error("put usage failed", put)
+	}
+	if err := q.Scan(context.Background()); nil != err {
+		t.Fatal("scan failed", err.Error())
+	}
+	if u := q.Usage()["fake"]; u != put {
+		t.Error("scan usage differs", u, put)
+	}
+
+	if err := c.DeleteObject(context.Background(), __ids[0]); nil != err {
+		t.Fatal("deleteObject failed", err.Error())
+	}
+	if u := q.Usage()["fake"]; u.Bytes != 0 || u.Chunks != 0 {
+		t.Error("delete usage failed", u)
+	}
+}
+
+func TestQuota_Rate(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	q, _ := New(log, &types.QuotaConfig{Rate: 8}, store)
+	c := q.Client()
+
+	if err := c.PutObject(context.Background(), __ids[0], []byte("cccccccc")); nil != err {
+		t.Fatal("putObject failed", err.Error())
+	}
+	if err := c.PutObject(context.Background(), __ids[1], []byte("cccccccc")); !types.IsRetryable(err) {
+		t.Error("rate quota failed", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package retention
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"strings"
+	"time"
+)
+
+const pageSize = 1000
+
+// ChunkRetention deletes chunks whose through time is older than the retention of their tenant.
+type ChunkRetention struct {
+	log      *zap.Logger
+	store    types.ObjectClient
+	retain   time.Duration
+	tenants  map[string]time.Duration
+	limiter  *rate.Limiter
+	interval time.Duration
+	dryRun   bool
+	periodic types.PeriodicTable
+}
+
+type ChunkStats struct {
+	Scanned int
+	Objects int
+	Bytes   int64
+}
+
+func NewChunkRetention(log *zap.Logger, conf *types.RetainConfig, store types.ObjectClient) (*ChunkRetention, error) {
+	tenants, err := ParseTenants(conf.Tenants)
+	if nil != err {
+		return nil, err
+	}
+
+	r := &ChunkRetention{
+		log:      log.With(zap.String("retention", "chunk")),
+		store:    store,
+		retain:   conf.Chunks,
+		tenants:  tenants,
+		limiter:  rate.NewLimiter(rate.Inf, 1),
+		interval: conf.Interval,
+		dryRun:   conf.DryRun,
+		periodic: types.PeriodicTable{Prefix: conf.Chunk, Period: conf.Period},
+	}
+	if conf.Rate > 0 {
+		r.limiter = rate.NewLimiter(rate.Limit(conf.Rate), conf.Rate)
+	}
+	if r.interval <= 0 {
+		r.interval = 10 * time.Minute
+	}
+
+	return r, nil
+}
+
+func (r *ChunkRetention) Run(ctx context.Context) {
+	if r.retain <= 0 && len(r.tenants) == 0 {
+		return
+	}
+	if _, err := types.Lister(r.store); nil != err {
+		r.log.Warn("chunk retention disabled", zap.Error(err))
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Sweep(ctx, time.Now()); nil != err && ctx.Err() == nil {
+			r.log.Error("sweep chunks", zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sweep walks the whole store once and deletes the expired chunks,
+// objects which are not chunks are left untouched.
+func (r *ChunkRetention) Sweep(ctx context.Context, now time.Time) (*ChunkStats, error) {
+	lister, err := types.Lister(r.store)
+	if nil != err {
+		return nil, err
+	}
+
+	stats := &ChunkStats{}
+	begin := time.Now()
+	defer func() {
+		r.log.Info("sweep chunks", zap.Int("scanned", stats.Scanned), zap.Int("objects", stats.Objects), zap.Int64("bytes", stats.Bytes), zap.Bool("dryrun", r.dryRun), zap.Duration("latency", time.Now().Sub(begin)))
+	}()
+
+	err = types.WalkObjects(ctx, lister, "", pageSize, func(o types.ObjectInfo) error {
+		stats.Scanned++
+		if !r.expired(o.Key, now) {
+			return nil
+		}
+		if err := r.delete(ctx, o); nil != err {
+			return ctx.Err()
+		}
+		stats.Objects++
+		stats.Bytes += o.Size
+		return nil
+	})
+
+	return stats, err
+}
+
+func (r *ChunkRetention) expired(key string, now time.Time) bool {
+	info, err := types.ParseCheckId(utils.ParseKey(key))
+	if nil != err {
+		return false
+	}
+
+	retain, ok := r.tenants[info.UserID]
+	if !ok {
+		retain = r.retain
+	}
+
+	return retain > 0 && info.Through.Before(now.Add(-retain))
+}
+
+func (r *ChunkRetention) delete(ctx context.Context, o types.ObjectInfo) error {
+	if r.dryRun {
+		r.log.Info("expired chunk", zap.String("key", o.Key), zap.Int64("length", o.Size), zap.Bool("dryrun", true))
+		return nil
+	}
+	if err := r.limiter.Wait(ctx); nil != err {
+		return err
+	}
+	if err := r.store.DeleteObject(utils.WithTable(ctx, r.table(o.Key)), o.Key); nil != err {
+		r.log.Error("delete chunk", zap.String("key", o.Key), zap.Error(err))
+		return err
+	}
+	r.log.Debug("delete chunk", zap.String("key", o.Key), zap.Int64("length", o.Size))
+
+	return nil
+}
+
+// table returns the periodic table loki wrote a flat chunk to, from the period of its from time,
+// the store routes chunks by table and flat keys do not carry it.
+func (r *ChunkRetention) table(key string) string {
+	info, err := types.ParseCheckId(utils.ParseKey(key))
+	if nil != err || strings.Count(key, "/") > 1 || "" == r.periodic.Prefix || r.periodic.Period < time.Second {
+		return ""
+	}
+	return r.periodic.Name(info.From)
+}
+
+// ParseTenants reads retentions per tenant written as "tenant=duration,tenant=duration".
+func ParseTenants(s string) (map[string]time.Duration, error) {
+	tenants := map[string]time.Duration{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); "" == kv {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, errors.Errorf("invalid tenant retention '%s'", kv)
+		}
+		d, err := time.ParseDuration(kv[i+1:])
+		if nil != err {
+			return nil, errors.Wrapf(err, "invalid tenant retention '%s'", kv)
+		}
+		tenants[kv[:i]] = d
+	}
+	return tenants, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package retention
+
+import (
+	"context"
+	"fmt"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestChunkRetention_Sweep(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	now := time.Unix(0, 0x17ab9b3889b*int64(time.Millisecond)).Add(48 * time.Hour)
+
+	keys := map[string]bool{
+		"fake/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60":            false,
+		"index_2650/fake/a70ecbaeaa65a26b_17ab9b3875f_17ab9b3889b_d8c9fe60": false,
+		"keep/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60":            true,
+		"tables.json": true,
+	}
+	for k := range keys {
+		if err := store.PutObject(context.Background(), k, []byte("cccc")); nil != err {
+			t.Fatal("putObject failed", err.Error())
+		}
+	}
+
+	r, err := NewChunkRetention(log, &types.RetainConfig{Chunks: 24 * time.Hour, Tenants: "keep=72h"}, store)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	stats, err := r.Sweep(context.Background(), now)
+	if nil != err {
+		t.Fatal("sweep failed", err.Error())
+	}
+	if stats.Objects != 2 || stats.Bytes != 8 || stats.Scanned != 4 {
+		t.Error("stats failed", stats)
+	}
+
+	objects, _, _ := store.(types.ObjectLister).ListObjects(context.Background(), "", "", 0)
+	for _, o := range objects {
+		if !keys[o.Key] {
+			t.Error("chunk not deleted", o.Key)
+		}
+	}
+	if len(objects) != 2 {
+		t.Error("chunk deleted", objects)
+	}
+}
+
+func TestChunkRetention_Recent(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	now := time.Now()
+
+	// loki writes the from and through of chunk ids as hex milliseconds
+	id := func(through time.Time) string {
+		ms := through.UnixNano() / int64(time.Millisecond)
+		return utils.FormatKey(fmt.Sprintf("fake/a70ecbaeaa65a26a:%x:%x:d8c9fe60", ms-3600000, ms))
+	}
+	recent, old := id(now.Add(-time.Hour)), id(now.Add(-48*time.Hour))
+	for _, k := range []string{recent, old} {
+		if err := store.PutObject(context.Background(), k, []byte("cccc")); nil != err {
+			t.Fatal("putObject failed", err.Error())
+		}
+	}
+
+	r, err := NewChunkRetention(log, &types.RetainConfig{Chunks: 24 * time.Hour}, store)
+	if nil != err {
+		t.Fatal("new failed", err.Error())
+	}
+	if _, err := r.Sweep(context.Background(), now); nil != err {
+		t.Fatal("sweep failed", err.Error())
+	}
+	if _, err := store.GetObject(context.Background(), recent); nil != err {
+		t.Error("recent chunk deleted", recent)
+	}
+	if buf, _ := store.GetObject(context.Background(), old); nil != buf {
+		t.Error("old chunk not deleted", old)
+	}
+}
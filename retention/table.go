@@ -0,0 +1,103 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package retention
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"time"
+)
+
+// TableRetention deletes periodic tables once their whole period is older than the retention.
+type TableRetention struct {
+	log      *zap.Logger
+	tables   types.TableClient
+	periodic []types.PeriodicTable
+	retain   time.Duration
+	interval time.Duration
+	dryRun   bool
+}
+
+func NewTableRetention(log *zap.Logger, conf *types.RetainConfig, tables types.TableClient) *TableRetention {
+	r := &TableRetention{
+		log:      log.With(zap.String("retention", "table")),
+		tables:   tables,
+		retain:   conf.Table,
+		interval: conf.Interval,
+		dryRun:   conf.DryRun,
+	}
+	for _, prefix := range []string{conf.Index, conf.Chunk} {
+		if "" != prefix {
+			r.periodic = append(r.periodic, types.PeriodicTable{Prefix: prefix, Period: conf.Period})
+		}
+	}
+	if r.interval <= 0 {
+		r.interval = 10 * time.Minute
+	}
+
+	return r
+}
+
+func (r *TableRetention) Run(ctx context.Context) {
+	if r.retain <= 0 || nil == r.tables {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Sweep(ctx, time.Now()); nil != err {
+			r.log.Error("sweep tables", zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sweep deletes every table whose period ended before now minus the retention and
+// returns their names, nothing is deleted in dry run mode.
+func (r *TableRetention) Sweep(ctx context.Context, now time.Time) ([]string, error) {
+	names, err := r.tables.ListTables(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	var expired []string
+	deadline := now.Add(-r.retain)
+	for _, name := range names {
+		through, ok := r.parse(name)
+		if !ok || through.After(deadline) {
+			continue
+		}
+		if r.dryRun {
+			r.log.Info("expired table", zap.String("table", name), zap.Time("through", through), zap.Bool("dryrun", true))
+			expired = append(expired, name)
+			continue
+		}
+
+		begin := time.Now()
+		if err := r.tables.DeleteTable(ctx, name); nil != err {
+			r.log.Error("delete table", zap.String("table", name), zap.Time("through", through), zap.Error(err))
+			continue
+		}
+		r.log.Info("delete table", zap.String("table", name), zap.Time("through", through), zap.Duration("latency", time.Now().Sub(begin)))
+		expired = append(expired, name)
+	}
+
+	return expired, nil
+}
+
+func (r *TableRetention) parse(name string) (time.Time, bool) {
+	for _, p := range r.periodic {
+		if _, through, ok := p.Parse(name); ok {
+			return through, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package retention
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"sort"
+	"testing"
+	"time"
+)
+
+type __tables map[string]bool
+
+func (t __tables) ListTables(ctx context.Context) ([]string, error) {
+	var names []string
+	for n := range t {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (t __tables) CreateTable(ctx context.Context, desc *api.TableDesc) error {
+	t[desc.Name] = true
+	return nil
+}
+
+func (t __tables) DeleteTable(ctx context.Context, name string) error {
+	delete(t, name)
+	return nil
+}
+
+func (t __tables) DescribeTable(ctx context.Context, name string) (*api.TableDesc, bool, error) {
+	return &api.TableDesc{Name: name}, t[name], nil
+}
+
+func (t __tables) UpdateTable(ctx context.Context, current, expected *api.TableDesc) error {
+	return nil
+}
+
+func TestTableRetention_Sweep(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	period := 24 * time.Hour
+	now := time.Unix(100*86400+3600, 0)
+	tables := __tables{"index_97": true, "index_98": true, "index_99": true, "chunks_97": true, "chunks_100": true, "other_1": true}
+	conf := &types.RetainConfig{Period: period, Index: "index_", Chunk: "chunks_", Table: 24 * time.Hour, DryRun: true}
+
+	expired, err := NewTableRetention(log, conf, tables).Sweep(context.Background(), now)
+	if nil != err {
+		t.Fatal("sweep failed", err.Error())
+	}
+	if len(expired) != 3 || len(tables) != 6 {
+		t.Error("dry run failed", expired, tables)
+	}
+
+	conf.DryRun = false
+	if _, err = NewTableRetention(log, conf, tables).Sweep(context.Background(), now); nil != err {
+		t.Fatal("sweep failed", err.Error())
+	}
+	for _, name := range []string{"index_97", "index_98", "chunks_97"} {
+		if tables[name] {
+			t.Error("table not deleted", name)
+		}
+	}
+	for _, name := range []string{"index_99", "chunks_100", "other_1"} {
+		if !tables[name] {
+			t.Error("table deleted", name)
+		}
+	}
+}
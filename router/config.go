@@ -0,0 +1,99 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package router
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"io/ioutil"
+	"path"
+	"time"
+)
+
+// Rule routes the names matching a path.Match pattern to a named store.
+type Rule struct {
+	Match string `json:"match"`
+	Store string `json:"store"`
+}
+
+// Period routes the periodic tables of a prefix once their period ended before through,
+// or more than older ago. Tables moved by older are still read from the store they had before.
+type Period struct {
+	Prefix  string    `json:"prefix"`
+	Period  Duration  `json:"period"`
+	Older   Duration  `json:"older"`
+	Through time.Time `json:"through"`
+	Store   string    `json:"store"`
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); nil != err {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+// Routes is the routing file, the stores are named store configs. Tenants are matched first,
+// then table names and periods, the first matching rule wins and anything else goes to the default store.
+type Routes struct {
+	Default string                     `json:"default"`
+	Stores  map[string]json.RawMessage `json:"stores"`
+	Tenants []Rule                     `json:"tenants"`
+	Tables  []Rule                     `json:"tables"`
+	Periods []Period                   `json:"periods"`
+}
+
+func Load(file string) (*Routes, error) {
+	buf, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+
+	routes := &Routes{}
+	if err = json.Unmarshal(buf, routes); nil != err {
+		return nil, errors.Wrapf(err, "invalid routing file '%s'", file)
+	}
+
+	return routes, nil
+}
+
+// store reads a named store config, the log level, mode, key schema, keyring and bloom filter interval default to the flags.
+func (r *Routes) store(name string, base *types.StoreConfig) (*types.StoreConfig, error) {
+	config := &types.StoreConfig{Level: base.Level, Mode: base.Mode, Schema: base.Schema, Keyring: base.Keyring, Sealed: base.Sealed, Rescan: base.Rescan}
+	if err := json.Unmarshal(r.Stores[name], config); nil != err {
+		return nil, errors.Wrapf(err, "invalid store '%s'", name)
+	}
+	config.Name = name
+
+	return config, nil
+}
+
+func match(rules []Rule, name string) (string, bool) {
+	for _, r := range rules {
+		if ok, _ := path.Match(r.Match, name); ok {
+			return r.Store, true
+		}
+	}
+	return "", false
+}
+
+func (p *Period) match(name string, now time.Time) (moved, ok bool) {
+	_, through, ok := types.PeriodicTable{Prefix: p.Prefix, Period: time.Duration(p.Period)}.Parse(name)
+	if !ok {
+		return false, false
+	}
+	if !p.Through.IsZero() && !through.After(p.Through) {
+		return false, true
+	}
+	if p.Older > 0 && through.Before(now.Add(-time.Duration(p.Older))) {
+		return true, true
+	}
+	return false, false
+}
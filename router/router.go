@@ -0,0 +1,337 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package router
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/driver"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultStore = "default"
+
+// Router sends every chunk to the store its tenant, table or table period is routed to,
+// other objects such as the index and the table catalog stay on the default store.
+type Router struct {
+	log      *zap.Logger
+	stores   map[string]types.ObjectClient
+	names    []string
+	fallback types.ObjectClient
+	tenants  []Rule
+	tables   []Rule
+	periods  []Period
+	now      func() time.Time
+}
+
+func New(log *zap.Logger, config *types.StoreConfig) types.ObjectClient {
+	r, err := Factory(log, config)
+	if nil != err {
+		panic(err)
+	}
+	return r
+}
+
+// Factory opens the store of the flags alone when there is no routing file,
+// otherwise that store is named after its config, or "default", next to the stores of the file.
+func Factory(log *zap.Logger, config *types.StoreConfig) (types.ObjectClient, error) {
+	if "" == config.Routes {
+		return driver.Factory(log, config)
+	}
+
+	routes, err := Load(config.Routes)
+	if nil != err {
+		return nil, err
+	}
+	return open(log, config, routes)
+}
+
+// Rewrap wraps the data keys of every store with a keyring under its active master key, one store after the other.
+func Rewrap(ctx context.Context, log *zap.Logger, config *types.StoreConfig) error {
+	configs := []*types.StoreConfig{config}
+	if "" != config.Routes {
+		routes, err := Load(config.Routes)
+		if nil != err {
+			return err
+		}
+		name := config.Name
+		if "" == name {
+			name = defaultStore
+		}
+		if _, ok := routes.Stores[name]; ok || "" == config.Driver {
+			configs = configs[:0]
+		}
+		for n := range routes.Stores {
+			c, err := routes.store(n, config)
+			if nil != err {
+				return err
+			}
+			configs = append(configs, c)
+		}
+	}
+
+	for _, c := range configs {
+		if "" == c.Keyring {
+			continue
+		}
+		if err := driver.Rewrap(ctx, log, c); nil != err {
+			return errors.Wrapf(err, "rewrap store '%s'", c.Name)
+		}
+	}
+	return nil
+}
+
+func open(log *zap.Logger, config *types.StoreConfig, routes *Routes) (types.ObjectClient, error) {
+	r := &Router{
+		log:     log.With(zap.String("router", config.Routes)),
+		stores:  map[string]types.ObjectClient{},
+		tenants: routes.Tenants,
+		tables:  routes.Tables,
+		periods: routes.Periods,
+		now:     time.Now,
+	}
+
+	name := config.Name
+	if "" == name {
+		name = defaultStore
+	}
+	if _, ok := routes.Stores[name]; !ok && "" != config.Driver {
+		store, err := driver.Factory(log, config)
+		if nil != err {
+			return nil, err
+		}
+		r.stores[name] = store
+	}
+	for n := range routes.Stores {
+		c, err := routes.store(n, config)
+		if nil != err {
+			return nil, err
+		}
+		store, err := driver.Factory(log, c)
+		if nil != err {
+			return nil, errors.Wrapf(err, "open store '%s'", n)
+		}
+		r.stores[n] = store
+	}
+
+	if "" != routes.Default {
+		name = routes.Default
+	}
+	if r.fallback = r.stores[name]; nil == r.fallback {
+		return nil, errors.Errorf("unknown default store '%s'", name)
+	}
+	for _, rule := range append(append([]Rule{}, r.tenants...), r.tables...) {
+		if _, ok := r.stores[rule.Store]; !ok {
+			return nil, errors.Errorf("unknown store '%s' of rule '%s'", rule.Store, rule.Match)
+		}
+	}
+	for _, p := range r.periods {
+		if _, ok := r.stores[p.Store]; !ok {
+			return nil, errors.Errorf("unknown store '%s' of period '%s'", p.Store, p.Prefix)
+		}
+		if time.Duration(p.Period) < time.Second {
+			return nil, errors.Errorf("invalid period of '%s'", p.Prefix)
+		}
+	}
+
+	clients := make([]types.ObjectClient, 0, len(r.stores))
+	for n, c := range r.stores {
+		r.names = append(r.names, n)
+		clients = append(clients, c)
+	}
+	sort.Strings(r.names)
+	r.log.Info("routing stores", zap.Strings("stores", r.names), zap.String("default", name))
+
+	return types.Decorate(r, clients...), nil
+}
+
+func (r *Router) PutObject(ctx context.Context, key string, object []byte) error {
+	return r.route(ctx, key)[0].PutObject(ctx, key, object)
+}
+
+// GetObject reads from the store of the key first, then from the store the table had before
+// it was moved by age, and at last from the other stores for chunks written under other rules.
+func (r *Router) GetObject(ctx context.Context, key string) (buf []byte, err error) {
+	for _, c := range r.lookup(ctx, key) {
+		if buf, err = c.GetObject(ctx, key); !types.IsNotFound(err) {
+			break
+		}
+	}
+	return buf, err
+}
+
+// DeleteObject deletes from the store of the key and the stores the table had before,
+// chunks whose table is unknown are deleted from every store as their table may be routed.
+func (r *Router) DeleteObject(ctx context.Context, key string) error {
+	stores := r.route(ctx, key)
+	if r.unrouted(ctx, key) {
+		stores = make([]types.ObjectClient, len(r.names))
+		for i, n := range r.names {
+			stores[i] = r.stores[n]
+		}
+	}
+
+	var missing error
+	deleted := false
+	for _, c := range stores {
+		e := c.DeleteObject(ctx, key)
+		switch {
+		case nil == e:
+			deleted = true
+		case types.IsNotFound(e):
+			missing = e
+		default:
+			return e
+		}
+	}
+	if deleted {
+		return nil
+	}
+	return missing
+}
+
+func (r *Router) Ping() error {
+	for _, n := range r.names {
+		if err := r.stores[n].Ping(); nil != err {
+			return errors.Wrapf(err, "ping store '%s'", n)
+		}
+	}
+	return nil
+}
+
+func (r *Router) Stat(ctx context.Context, key string) (info *types.ObjectInfo, err error) {
+	for _, c := range r.lookup(ctx, key) {
+		if info, err = c.(types.ObjectStater).Stat(ctx, key); !types.IsNotFound(err) {
+			break
+		}
+	}
+	return info, err
+}
+
+// ListObjects lists the stores one after the other, the continuation is the index
+// of the store followed by the continuation of that store.
+func (r *Router) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	i, cursor := 0, ""
+	if "" != after {
+		j := strings.IndexByte(after, ':')
+		if j <= 0 {
+			return nil, "", errors.Errorf("invalid continuation '%s'", after)
+		}
+		n, err := strconv.Atoi(after[:j])
+		if nil != err || n < 0 {
+			return nil, "", errors.Errorf("invalid continuation '%s'", after)
+		}
+		i, cursor = n, after[j+1:]
+	}
+
+	for ; i < len(r.names); i, cursor = i+1, "" {
+		n := r.names[i]
+		objects, next, err := r.stores[n].(types.ObjectLister).ListObjects(ctx, prefix, cursor, limit)
+		if nil != err {
+			return nil, "", errors.Wrapf(err, "list store '%s'", n)
+		}
+		if "" != next {
+			return objects, strconv.Itoa(i) + ":" + next, nil
+		}
+		if len(objects) > 0 && i+1 < len(r.names) {
+			return objects, strconv.Itoa(i+1) + ":", nil
+		}
+		if len(objects) > 0 {
+			return objects, "", nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// route returns the store of the key, followed by the store it had before when a period rule moved it.
+func (r *Router) route(ctx context.Context, key string) []types.ObjectClient {
+	info, err := types.ParseCheckId(utils.ParseKey(key))
+	if nil != err {
+		return []types.ObjectClient{r.fallback}
+	}
+	if name, ok := match(r.tenants, info.UserID); ok {
+		return []types.ObjectClient{r.stores[name]}
+	}
+
+	table := utils.Table(ctx)
+	if "" == table {
+		table = tableOf(key)
+	}
+	if "" == table {
+		return []types.ObjectClient{r.fallback}
+	}
+	if name, ok := match(r.tables, table); ok {
+		return []types.ObjectClient{r.stores[name]}
+	}
+
+	var stores []types.ObjectClient
+	now := r.now()
+	for _, p := range r.periods {
+		moved, ok := p.match(table, now)
+		if !ok {
+			continue
+		}
+		if stores = append(stores, r.stores[p.Store]); !moved {
+			return stores
+		}
+	}
+
+	if n := len(stores); n > 0 && stores[n-1] == r.fallback {
+		return stores
+	}
+	return append(stores, r.fallback)
+}
+
+// lookup returns the stores a chunk is read from, its routes followed by the other stores,
+// as a chunk stays on the store it was written to when the rules change.
+func (r *Router) lookup(ctx context.Context, key string) []types.ObjectClient {
+	stores := r.route(ctx, key)
+	if _, err := types.ParseCheckId(utils.ParseKey(key)); nil != err || len(stores) == len(r.names) {
+		return stores
+	}
+
+	for _, n := range r.names {
+		c, routed := r.stores[n], false
+		for _, s := range stores {
+			routed = routed || s == c
+		}
+		if !routed {
+			stores = append(stores, c)
+		}
+	}
+	return stores
+}
+
+// unrouted reports a chunk which would be routed by its table, when the table is unknown.
+func (r *Router) unrouted(ctx context.Context, key string) bool {
+	if len(r.tables) == 0 && len(r.periods) == 0 || "" != utils.Table(ctx) || "" != tableOf(key) {
+		return false
+	}
+	info, err := types.ParseCheckId(utils.ParseKey(key))
+	if nil != err {
+		return false
+	}
+	_, ok := match(r.tenants, info.UserID)
+	return !ok
+}
+
+// tableOf returns the table prefix of a key written in the table layout.
+func tableOf(key string) string {
+	i := strings.LastIndexByte(key, '/')
+	if i < 0 {
+		return ""
+	}
+	j := strings.LastIndexByte(key[:i], '/')
+	if j <= 0 {
+		return ""
+	}
+	return key[:j]
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package router
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const __routes = `{
+	"default": "public",
+	"stores": {
+		"private": {"driver": "memory"},
+		"public": {"driver": "memory"}
+	},
+	"tenants": [
+		{"match": "finance", "store": "private"},
+		{"match": "team-*", "store": "private"}
+	]
+}`
+
+func __router(t *testing.T, routes string) *Router {
+	dir, err := ioutil.TempDir("", "router")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := filepath.Join(dir, "routes.json")
+	if err := ioutil.WriteFile(file, []byte(routes), 0644); nil != err {
+		t.Fatal("writeFile failed", err.Error())
+	}
+
+	log, _ := zap.NewDevelopment()
+	c, err := Factory(log, &types.StoreConfig{Driver: "memory", Routes: file})
+	if nil != err {
+		t.Fatal("factory failed", err.Error())
+	}
+	return c.(*Router)
+}
+
+func TestRouter_Tenant(t *testing.T) {
+	r := __router(t, __routes)
+
+	cases := map[string]string{
+		"finance/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60":            "private",
+		"chunks_2650/team-a/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60": "private",
+		"fake/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60":               "public",
+		"tables.json": "public",
+	}
+	for key, store := range cases {
+		if err := r.PutObject(context.Background(), key, []byte(key)); nil != err {
+			t.Error("putObject failed", key, err.Error())
+		}
+		if buf, err := r.stores[store].GetObject(context.Background(), key); nil != err || string(buf) != key {
+			t.Error("route failed", key, store, err)
+		}
+	}
+
+	for _, limit := range []int{1, 3, 0} {
+		seen := map[string]bool{}
+		if err := types.WalkObjects(context.Background(), r, "", limit, func(o types.ObjectInfo) error {
+			seen[o.Key] = true
+			return nil
+		}); nil != err || len(seen) != len(cases) {
+			t.Error("listObjects failed", limit, seen, err)
+		}
+	}
+}
+
+func TestRouter_Invalid(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	routes := &Routes{Tenants: []Rule{{Match: "finance", Store: "private"}}}
+	if _, err := open(log, &types.StoreConfig{Driver: "memory"}, routes); nil == err {
+		t.Error("unknown store accepted")
+	}
+}
+
+const __tables = `{
+	"default": "fast",
+	"stores": {
+		"fast": {"driver": "memory"},
+		"cloud": {"driver": "memory"},
+		"archive": {"driver": "memory"}
+	},
+	"tables": [
+		{"match": "pinned_*", "store": "fast"}
+	],
+	"periods": [
+		{"prefix": "chunks_", "period": "24h", "through": "1970-03-01T00:00:00Z", "store": "archive"},
+		{"prefix": "chunks_", "period": "24h", "older": "72h", "store": "cloud"}
+	]
+}`
+
+func TestRouter_Table(t *testing.T) {
+	r := __router(t, __tables)
+	day := func(n int64) func() time.Time {
+		return func() time.Time { return time.Unix(n*86400+3600, 0) }
+	}
+	id := "fake/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60"
+
+	r.now = day(100)
+	young := utils.WithTable(context.Background(), "chunks_99")
+	if err := r.PutObject(young, id, []byte("young")); nil != err {
+		t.Fatal("putObject failed", err.Error())
+	}
+	if _, err := r.stores["fast"].GetObject(context.Background(), id); nil != err {
+		t.Error("young table not on fast store", err)
+	}
+
+	r.now = day(110)
+	if buf, err := r.GetObject(young, id); nil != err || string(buf) != "young" {
+		t.Error("moved table fallback failed", err)
+	}
+	if err := r.PutObject(young, "chunks_99/"+id, []byte("old")); nil != err {
+		t.Fatal("putObject failed", err.Error())
+	}
+	if _, err := r.stores["cloud"].GetObject(context.Background(), "chunks_99/"+id); nil != err {
+		t.Error("old table not on cloud store", err)
+	}
+
+	cases := map[string]string{"chunks_10": "archive", "pinned_1": "fast", "other": "fast"}
+	for table, store := range cases {
+		if err := r.PutObject(utils.WithTable(context.Background(), table), id, []byte(table)); nil != err {
+			t.Fatal("putObject failed", err.Error())
+		}
+		if buf, _ := r.stores[store].GetObject(context.Background(), id); string(buf) != table {
+			t.Error("route table failed", table, store)
+		}
+	}
+
+	// without its table a chunk is deleted from every store
+	if err := r.DeleteObject(context.Background(), id); nil != err {
+		t.Error("deleteObject failed", err.Error())
+	}
+	for _, store := range cases {
+		if _, err := r.stores[store].GetObject(context.Background(), id); !types.IsNotFound(err) {
+			t.Error("unrouted delete failed", store, err)
+		}
+	}
+}
+
+func TestRouter_Lookup(t *testing.T) {
+	r := __router(t, __tables)
+	id := "fake/a70ecbaeaa65a26a_17ab9b3875f_17ab9b3889b_d8c9fe60"
+
+	// written before a rule routed its table to the archive
+	ctx := utils.WithTable(context.Background(), "chunks_10")
+	r.stores["fast"].PutObject(context.Background(), id, []byte("moved"))
+	if buf, err := r.GetObject(ctx, id); nil != err || string(buf) != "moved" {
+		t.Error("lookup failed", err)
+	}
+	if _, err := r.Stat(ctx, id); nil != err {
+		t.Error("stat lookup failed", err)
+	}
+	if _, err := r.GetObject(context.Background(), "index/manifest"); !types.IsNotFound(err) {
+		t.Error("missing object found", err)
+	}
+}
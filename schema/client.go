@@ -0,0 +1,92 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package schema
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"strings"
+)
+
+// client maps the legacy chunk keys used by the service to the keys of a schema,
+// a table prefix in front of the tenant is kept and other objects pass through.
+type client struct {
+	schema types.KeySchema
+	store  types.ObjectClient
+}
+
+func Wrap(schema types.KeySchema, store types.ObjectClient) types.ObjectClient {
+	return types.Decorate(&client{schema: schema, store: store}, store)
+}
+
+func (c *client) PutObject(ctx context.Context, key string, object []byte) error {
+	return c.store.PutObject(ctx, c.encode(key), object)
+}
+
+func (c *client) GetObject(ctx context.Context, key string) ([]byte, error) {
+	return c.store.GetObject(ctx, c.encode(key))
+}
+
+func (c *client) DeleteObject(ctx context.Context, key string) error {
+	return c.store.DeleteObject(ctx, c.encode(key))
+}
+
+func (c *client) Ping() error {
+	return c.store.Ping()
+}
+
+// ListObjects lists the raw keys under the prefix and returns them in the legacy layout,
+// the continuation key stays a raw key.
+func (c *client) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	objects, next, err := c.store.(types.ObjectLister).ListObjects(ctx, prefix, after, limit)
+	for i := range objects {
+		objects[i].Key = c.decode(objects[i].Key)
+	}
+	return objects, next, err
+}
+
+func (c *client) Stat(ctx context.Context, key string) (*types.ObjectInfo, error) {
+	info, err := c.store.(types.ObjectStater).Stat(ctx, c.encode(key))
+	if nil != info {
+		info.Key = key
+	}
+	return info, err
+}
+
+func (c *client) encode(key string) string {
+	i := strings.LastIndexByte(key, '/')
+	if i < 0 {
+		return key
+	}
+	j := strings.LastIndexByte(key[:i], '/')
+
+	info, err := types.ParseCheckId(utils.ParseKey(key))
+	if nil != err {
+		return key
+	}
+	return key[:j+1] + c.schema.Encode(info)
+}
+
+func (c *client) decode(key string) string {
+	if i, id, ok := find(c.schema, key); ok {
+		return key[:i] + utils.FormatKey(id)
+	}
+	return key
+}
+
+// find returns the chunk id of a raw key and where it starts, after a table prefix.
+func find(schema types.KeySchema, key string) (int, string, bool) {
+	for i := 0; i <= len(key); {
+		if id, ok := schema.Decode(key[i:]); ok {
+			return i, id, true
+		}
+		j := strings.IndexByte(key[i:], '/')
+		if j < 0 {
+			break
+		}
+		i += j + 1
+	}
+	return 0, "", false
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package schema
+
+import (
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+)
+
+const legacy = "legacy"
+
+var schema = map[string]types.KeySchema{
+	legacy:   Legacy{},
+	"day":    Day{},
+	"hash":   Hash{},
+	"base64": Base64{},
+}
+
+func Register(name string, s types.KeySchema) {
+	schema[name] = s
+}
+
+// Factory lays out the chunk keys of the store with the schema of its config,
+// the legacy schema leaves the store untouched.
+func Factory(log *zap.Logger, config *types.StoreConfig, store types.ObjectClient) (types.ObjectClient, error) {
+	if "" == config.Schema || legacy == config.Schema {
+		return store, nil
+	}
+	if s, ok := schema[config.Schema]; ok {
+		log.Debug("key schema", zap.String("schema", config.Schema))
+		return Wrap(s, store), nil
+	}
+	return nil, errors.Errorf("can not support key schema '%s'", config.Schema)
+}
+
+// Decoder returns the inverse of the schema of the store, it maps the raw key of a chunk
+// to its id and tells the chunks apart from the other objects.
+func Decoder(config *types.StoreConfig) (func(key string) (string, bool), error) {
+	name := config.Schema
+	if "" == name {
+		name = legacy
+	}
+	s, ok := schema[name]
+	if !ok {
+		return nil, errors.Errorf("can not support key schema '%s'", config.Schema)
+	}
+	return func(key string) (string, bool) {
+		_, id, ok := find(s, key)
+		return id, ok
+	}, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package schema
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// Legacy is the historical layout "tenant/fp_from_through_checksum".
+type Legacy struct{}
+
+func (Legacy) Encode(info *types.CheckInfo) string {
+	return utils.FormatKey(info.Id)
+}
+
+func (Legacy) Decode(key string) (string, bool) {
+	i := strings.IndexByte(key, '/')
+	if i <= 0 || strings.IndexByte(key[i+1:], '/') >= 0 {
+		return "", false
+	}
+	return valid(utils.UnescapeTenant(key[:i+1]) + utils.UnescapeKey(key[i+1:]))
+}
+
+// Day shards the chunks of a tenant by the day they start and their stream,
+// "tenant/2006-01-02/fp/from_through_checksum".
+type Day struct{}
+
+func (Day) Encode(info *types.CheckInfo) string {
+	i := strings.IndexByte(info.Id, '/')
+	parts := strings.SplitN(info.Id[i+1:], ":", 2)
+
+	return utils.EscapeTenant(info.UserID) + "/" + info.From.UTC().Format("2006-01-02") + "/" + parts[0] + "/" + utils.FormatKey(parts[1])
+}
+
+func (Day) Decode(key string) (string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 4 {
+		return "", false
+	}
+	if _, err := time.Parse("2006-01-02", parts[1]); nil != err {
+		return "", false
+	}
+	return valid(utils.UnescapeTenant(parts[0]) + "/" + parts[2] + ":" + utils.UnescapeKey(parts[3]))
+}
+
+// Hash spreads the chunks over 65536 prefixes in front of the legacy layout,
+// "ffff/tenant/fp_from_through_checksum".
+type Hash struct{}
+
+func (Hash) Encode(info *types.CheckInfo) string {
+	return hash(info.Id) + "/" + utils.FormatKey(info.Id)
+}
+
+func (Hash) Decode(key string) (string, bool) {
+	i := strings.IndexByte(key, '/')
+	if i != 4 {
+		return "", false
+	}
+	id, ok := Legacy{}.Decode(key[i+1:])
+	if !ok || hash(id) != key[:i] {
+		return "", false
+	}
+	return id, true
+}
+
+func hash(id string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return fmt.Sprintf("%04x", h.Sum32()&0xffff)
+}
+
+// Base64 is the layout of the loki filesystem object client, the chunk id encoded with standard base64.
+type Base64 struct{}
+
+func (Base64) Encode(info *types.CheckInfo) string {
+	return base64.StdEncoding.EncodeToString([]byte(info.Id))
+}
+
+func (Base64) Decode(key string) (string, bool) {
+	buf, err := base64.StdEncoding.DecodeString(key)
+	if nil != err {
+		return "", false
+	}
+	return valid(string(buf))
+}
+
+func valid(id string) (string, bool) {
+	if _, err := types.ParseCheckId(id); nil != err {
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package schema
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"testing"
+)
+
+var __id = "fake/a70ecbaeaa65a26a:17ab9b3875f:17ab9b3889b:d8c9fe60"
+
+func TestSchema_RoundTrip(t *testing.T) {
+	for _, id := range []string{__id, "team:a" + __id[4:], "team_a" + __id[4:]} {
+		info, err := types.ParseCheckId(id)
+		if nil != err {
+			t.Fatal("parseCheckId failed", err.Error())
+		}
+
+		for name, s := range schema {
+			key := s.Encode(info)
+			if dec, ok := s.Decode(key); !ok || dec != id {
+				t.Error("round trip failed", name, key, dec)
+			}
+			if _, ok := s.Decode("index/index_2650/manifest"); ok {
+				t.Error("decode non chunk failed", name)
+			}
+		}
+	}
+	info, _ := types.ParseCheckId(__id)
+	if key := (Day{}).Encode(info); key != "fake/2021-07-18/a70ecbaeaa65a26a/17ab9b3875f_17ab9b3889b_d8c9fe60" {
+		t.Error("day layout failed", key)
+	}
+}
+
+func TestSchema_Client(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store, _ := memory.Factory(log, &types.StoreConfig{Driver: "memory"})
+
+	for name := range schema {
+		c, err := Factory(log, &types.StoreConfig{Schema: name}, store)
+		if nil != err {
+			t.Fatal("factory failed", name, err.Error())
+		}
+
+		keys := []string{"chunks_2650/" + utils.FormatKey(__id), "tables.json"}
+		for _, key := range keys {
+			if err := c.PutObject(context.Background(), key, []byte(key)); nil != err {
+				t.Error("putObject failed", name, err.Error())
+			}
+			if buf, err := c.GetObject(context.Background(), key); nil != err || string(buf) != key {
+				t.Error("getObject failed", name, key, err)
+			}
+		}
+
+		lister, err := types.Lister(c)
+		if nil != err {
+			t.Fatal("lister failed", name, err.Error())
+		}
+		objects, _, err := lister.ListObjects(context.Background(), "chunks_2650/", "", 10)
+		if nil != err || len(objects) != 1 || objects[0].Key != keys[0] {
+			t.Error("listObjects failed", name, objects, err)
+		}
+
+		for _, key := range keys {
+			_ = c.DeleteObject(context.Background(), key)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package server
+
+import (
+	"expvar"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// serveAdmin serves the expvar counters at /debug/vars and the handlers registered by the stores.
+func (s *Server) serveAdmin() {
+	if "" == s.config.Server.Admin {
+		return
+	}
+
+	s.admin.Handle("/debug/vars", expvar.Handler())
+	srv := &http.Server{Addr: s.config.Server.Admin, Handler: s.admin}
+	s.http = srv
+
+	go func() {
+		s.log.Info("admin listening at", zap.String("addr", srv.Addr))
+		if err := srv.ListenAndServe(); nil != err && http.ErrServerClosed != err {
+			s.log.Error("admin serve failed", zap.Error(err))
+		}
+	}()
+}
@@ -4,26 +4,39 @@
 package server
 
 import (
+	"context"
 	"github/vlorc/loki-grpc-storage/api"
-	"github/vlorc/loki-grpc-storage/driver"
+	"github/vlorc/loki-grpc-storage/index"
+	"github/vlorc/loki-grpc-storage/quota"
+	"github/vlorc/loki-grpc-storage/retention"
+	"github/vlorc/loki-grpc-storage/router"
 	"github/vlorc/loki-grpc-storage/service"
+	"github/vlorc/loki-grpc-storage/table"
 	"github/vlorc/loki-grpc-storage/types"
 	"github/vlorc/loki-grpc-storage/wrapper"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"io"
 	"net"
+	"net/http"
 )
 
 type Server struct {
 	log    *zap.Logger
 	config *types.Config
 	server *grpc.Server
+	index  types.IndexClient
+	store  io.Closer
+	cancel context.CancelFunc
+	admin  *http.ServeMux
+	http   *http.Server
 }
 
 func NewServer(config *types.Config) *Server {
 	return &Server{
 		log:    types.NewLog(&config.Log),
 		config: config,
+		admin:  http.NewServeMux(),
 	}
 }
 
@@ -53,11 +66,50 @@ func (s *Server) Stop() {
 		s.log.Info("server is being stopped")
 		s.server.Stop()
 	}
+	if nil != s.http {
+		_ = s.http.Close()
+	}
+	if nil != s.cancel {
+		s.cancel()
+	}
+	if nil != s.store {
+		_ = s.store.Close()
+	}
+	if nil != s.index {
+		_ = s.index.Close()
+	}
 }
 
 func (s *Server) register(ss *grpc.Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	object := router.New(s.log, &s.config.Store)
+	if quota.Enabled(&s.config.Quota) {
+		q, err := quota.New(s.log, &s.config.Quota, object)
+		if nil != err {
+			panic(err)
+		}
+		object = q.Client()
+		s.admin.Handle("/quota", q)
+		go q.Run(ctx)
+	}
+	s.index = index.New(s.log, &s.config.Index, object)
+	tables := table.New(s.log, &s.config.Table, object, s.index.DeleteTable, service.ChunkDropper(s.log, &s.config.Chunk, object))
+
+	store := service.NewStoreService(s.log, &s.config.Chunk, object, s.index, tables)
+	if c, ok := store.(io.Closer); ok {
+		s.store = c
+	}
 
-	store := service.NewStoreService(s.log, &s.config.Chunk, driver.New(s.log, &s.config.Store))
+	go retention.NewTableRetention(s.log, &s.config.Retain, tables).Run(ctx)
+
+	chunks, err := retention.NewChunkRetention(s.log, &s.config.Retain, object)
+	if nil != err {
+		panic(err)
+	}
+	go chunks.Run(ctx)
 
 	api.RegisterGrpcStoreServer(ss, store)
+	s.serveAdmin()
 }
@@ -0,0 +1,123 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"github/vlorc/loki-grpc-storage/api"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize  = 3 << 20
+	defaultBatchCount = 64
+)
+
+// batcher packs fetched chunks into GetChunksResponse messages bounded by size in bytes and count,
+// pending chunks are flushed after the flush interval so a slow fetch does not hold back the others.
+type batcher struct {
+	log    *zap.Logger
+	srv    api.GrpcStore_GetChunksServer
+	size   int
+	count  int
+	flush  time.Duration
+	lock   sync.Mutex
+	chunks []*api.Chunk
+	bytes  int
+	timer  *time.Timer
+	err    error
+}
+
+func newBatcher(log *zap.Logger, srv api.GrpcStore_GetChunksServer, size, count int, flush time.Duration) *batcher {
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	if count <= 0 {
+		count = defaultBatchCount
+	}
+	return &batcher{log: log, srv: srv, size: size, count: count, flush: flush}
+}
+
+func (b *batcher) add(chunk *api.Chunk) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if nil != b.err {
+		return b.err
+	}
+
+	n := chunk.Size()
+	if len(b.chunks) > 0 && b.bytes+n > b.size {
+		if err := b.send(); nil != err {
+			return err
+		}
+	}
+
+	b.chunks = append(b.chunks, chunk)
+	b.bytes += n
+
+	if len(b.chunks) >= b.count || b.bytes >= b.size || b.flush <= 0 {
+		return b.send()
+	}
+	if len(b.chunks) > 1 {
+		return nil
+	}
+	if nil == b.timer {
+		b.timer = time.AfterFunc(b.flush, b.tick)
+	} else {
+		b.timer.Reset(b.flush)
+	}
+
+	return nil
+}
+
+func (b *batcher) tick() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if nil == b.err {
+		_ = b.send()
+	}
+}
+
+// close sends the pending chunks and returns the first error of the stream.
+func (b *batcher) close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if nil != b.timer {
+		b.timer.Stop()
+	}
+	if nil == b.err {
+		_ = b.send()
+	}
+
+	return b.err
+}
+
+func (b *batcher) send() error {
+	if len(b.chunks) == 0 {
+		return nil
+	}
+
+	chunks, bytes := b.chunks, b.bytes
+	b.chunks, b.bytes = nil, 0
+	if nil != b.timer {
+		b.timer.Stop()
+	}
+	if nil == b.srv {
+		return nil
+	}
+
+	now := time.Now()
+	if err := b.srv.Send(&api.GetChunksResponse{Chunks: chunks}); nil != err {
+		b.log.Error("sendObject", zap.Int("count", len(chunks)), zap.Int("length", bytes), zap.Duration("latency", time.Now().Sub(now)), zap.Error(err))
+		b.err = err
+		return err
+	}
+	b.log.Debug("sendObject", zap.Int("count", len(chunks)), zap.Int("length", bytes), zap.Duration("latency", time.Now().Sub(now)))
+
+	return nil
+}
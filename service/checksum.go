@@ -0,0 +1,73 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"expvar"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"hash/crc32"
+)
+
+const (
+	verifyOff     = "off"
+	verifyLog     = "log"
+	verifyEnforce = "enforce"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var checksums = expvar.NewMap("chunk_checksum")
+
+// checksum compares the data with the crc32 carried by the chunk id, the same checksum loki
+// computes over the encoded chunk, keys which are not chunk ids are not verified.
+func checksum(key string, data []byte) (expected, actual uint32, ok bool) {
+	info, err := types.ParseCheckId(key)
+	if nil != err || !info.ChecksumSet {
+		return 0, 0, true
+	}
+	actual = crc32.Checksum(data, castagnoli)
+	return info.Checksum, actual, info.Checksum == actual
+}
+
+// verifyPut rejects corrupt uploads with InvalidArgument in enforce mode.
+func (s *StoreService) verifyPut(log *zap.Logger, key string, data []byte) error {
+	if verifyOff == s.verify || "" == s.verify {
+		return nil
+	}
+	expected, actual, ok := checksum(key, data)
+	if ok {
+		return nil
+	}
+
+	checksums.Add("put_mismatch", 1)
+	log.Warn("checksum mismatch", zap.String("key", key), zap.Int("length", len(data)), zap.Uint32("expected", expected), zap.Uint32("actual", actual), zap.String("verify", s.verify))
+	if verifyEnforce != s.verify {
+		return nil
+	}
+
+	return status.Errorf(codes.InvalidArgument, "chunk '%s' checksum %08x, expected %08x", key, actual, expected)
+}
+
+// verifyGet reports corrupt objects fetched from the driver as KindCorrupt in enforce mode.
+func (s *StoreService) verifyGet(log *zap.Logger, key string, data []byte) error {
+	if verifyOff == s.verify || "" == s.verify {
+		return nil
+	}
+	expected, actual, ok := checksum(key, data)
+	if ok {
+		return nil
+	}
+
+	checksums.Add("get_mismatch", 1)
+	log.Warn("checksum mismatch", zap.String("key", key), zap.Int("length", len(data)), zap.Uint32("expected", expected), zap.Uint32("actual", actual), zap.String("verify", s.verify))
+	if verifyEnforce != s.verify {
+		return nil
+	}
+
+	return types.NewError(types.KindCorrupt, key, errors.Errorf("checksum %08x, expected %08x", actual, expected))
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+)
+
+var __codes = map[types.ErrorKind]codes.Code{
+	types.KindNotFound:         codes.NotFound,
+	types.KindPermissionDenied: codes.PermissionDenied,
+	types.KindThrottled:        codes.ResourceExhausted,
+	types.KindUnavailable:      codes.Unavailable,
+	types.KindInvalidKey:       codes.InvalidArgument,
+	types.KindTimeout:          codes.DeadlineExceeded,
+	types.KindCorrupt:          codes.DataLoss,
+	types.KindQuota:            codes.ResourceExhausted,
+}
+
+// statusError converts the errors of drivers into grpc status,
+// so clients can tell retryable failures from permanent ones.
+func statusError(err error) error {
+	if nil == err {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if e, ok := err.(*chunkErrors); ok {
+		return e.status()
+	}
+
+	switch errors.Cause(err) {
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	if code, ok := __codes[types.KindOfError(err)]; ok {
+		return status.Error(code, err.Error())
+	}
+
+	return status.Error(codes.Unknown, err.Error())
+}
+
+type chunkError struct {
+	key string
+	err error
+}
+
+// chunkErrors collects the failures of a batch of chunks, it is safe for concurrent use.
+type chunkErrors struct {
+	lock   sync.Mutex
+	errors []chunkError
+}
+
+func (e *chunkErrors) add(key string, err error) {
+	e.lock.Lock()
+	e.errors = append(e.errors, chunkError{key: key, err: err})
+	e.lock.Unlock()
+}
+
+func (e *chunkErrors) skip(chunks []*api.Chunk, err error) {
+	e.lock.Lock()
+	for _, c := range chunks {
+		e.errors = append(e.errors, chunkError{key: c.GetKey(), err: err})
+	}
+	e.lock.Unlock()
+}
+
+func (e *chunkErrors) len() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return len(e.errors)
+}
+
+func (e *chunkErrors) err() error {
+	if e.len() == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *chunkErrors) Error() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.message()
+}
+
+func (e *chunkErrors) message() string {
+	if len(e.errors) == 1 {
+		return fmt.Sprintf("chunk '%s': %s", e.errors[0].key, e.errors[0].err)
+	}
+	return fmt.Sprintf("%d chunks failed, first '%s': %s", len(e.errors), e.errors[0].key, e.errors[0].err)
+}
+
+// status takes the code of the first failure and lists every failed key
+// as a ResourceInfo detail, so the client only retries those chunks.
+func (e *chunkErrors) status() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	code := status.Code(statusError(e.errors[0].err))
+	st := status.New(code, e.message())
+
+	details := make([]proto.Message, len(e.errors))
+	for i := range e.errors {
+		details[i] = &errdetails.ResourceInfo{
+			ResourceType: "chunk",
+			ResourceName: e.errors[i].key,
+			Description:  e.errors[i].err.Error(),
+		}
+	}
+	if d, err := st.WithDetails(details...); nil == err {
+		st = d
+	}
+
+	return st.Err()
+}
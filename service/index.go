@@ -0,0 +1,76 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+func (s *StoreService) WriteIndex(ctx context.Context, req *api.WriteIndexRequest) (*empty.Empty, error) {
+	if nil == s.index {
+		return &empty.Empty{}, status.Errorf(codes.Unimplemented, "method WriteIndex not implemented")
+	}
+
+	log := utils.Log(ctx, s.log)
+	writes := req.GetWrites()
+	now := time.Now()
+
+	err := s.index.WriteIndex(ctx, writes)
+	if nil != err {
+		log.Error("writeIndex", zap.Int("count", len(writes)), zap.Duration("latency", time.Now().Sub(now)), zap.Error(err))
+	} else {
+		log.Debug("writeIndex", zap.Int("count", len(writes)), zap.Duration("latency", time.Now().Sub(now)))
+	}
+
+	return &empty.Empty{}, statusError(err)
+}
+
+func (s *StoreService) QueryIndex(req *api.QueryIndexRequest, srv api.GrpcStore_QueryIndexServer) error {
+	if nil == s.index {
+		return status.Errorf(codes.Unimplemented, "method QueryIndex not implemented")
+	}
+
+	ctx := srv.Context()
+	log := utils.Log(ctx, s.log)
+	count := 0
+	now := time.Now()
+
+	err := s.index.QueryIndex(ctx, req, func(rows []*api.Row) error {
+		count += len(rows)
+		return srv.Send(&api.QueryIndexResponse{Rows: rows})
+	})
+	if nil != err {
+		log.Error("queryIndex", zap.String("table", req.GetTableName()), zap.String("hash", req.GetHashValue()), zap.Int("count", count), zap.Duration("latency", time.Now().Sub(now)), zap.Error(err))
+	} else {
+		log.Debug("queryIndex", zap.String("table", req.GetTableName()), zap.String("hash", req.GetHashValue()), zap.Int("count", count), zap.Duration("latency", time.Now().Sub(now)))
+	}
+
+	return statusError(err)
+}
+
+func (s *StoreService) DeleteIndex(ctx context.Context, req *api.DeleteIndexRequest) (*empty.Empty, error) {
+	if nil == s.index {
+		return &empty.Empty{}, status.Errorf(codes.Unimplemented, "method DeleteIndex not implemented")
+	}
+
+	log := utils.Log(ctx, s.log)
+	deletes := req.GetDeletes()
+	now := time.Now()
+
+	err := s.index.DeleteIndex(ctx, deletes)
+	if nil != err {
+		log.Error("deleteIndex", zap.Int("count", len(deletes)), zap.Duration("latency", time.Now().Sub(now)), zap.Error(err))
+	} else {
+		log.Debug("deleteIndex", zap.Int("count", len(deletes)), zap.Duration("latency", time.Now().Sub(now)))
+	}
+
+	return &empty.Empty{}, statusError(err)
+}
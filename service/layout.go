@@ -0,0 +1,94 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"time"
+)
+
+const (
+	layoutFlat  = "flat"
+	layoutTable = "table"
+)
+
+// objectKey returns a key of its own, the drivers keep it in their errors.
+func (s *StoreService) objectKey(table, key string) string {
+	if layoutTable != s.layout || "" == table {
+		return utils.FormatKey(key)
+	}
+	return table + "/" + utils.FormatKey(key)
+}
+
+// chunkTable returns the periodic table loki writes a chunk to, named after the period of its from time.
+func (s *StoreService) chunkTable(key string) string {
+	info, err := types.ParseCheckId(key)
+	if nil != err || s.period < time.Second {
+		return ""
+	}
+	return types.PeriodicTable{Prefix: s.table, Period: s.period}.Name(info.From)
+}
+
+// keys returns the keys a chunk may be stored under, the key it is written to first, then the flat key
+// of chunks written before the table layout was enabled and the keys of the ids escaped since.
+func (s *StoreService) keys(table, key string) []string {
+	keys := []string{s.objectKey(table, key)}
+	if layoutTable == s.layout && "" != table {
+		keys = append(keys, utils.FormatKey(key))
+	}
+	if legacy := utils.LegacyKey(key); legacy != utils.FormatKey(key) {
+		if layoutTable == s.layout && "" != table {
+			keys = append(keys, table+"/"+legacy)
+		}
+		keys = append(keys, legacy)
+	}
+	return keys
+}
+
+// getObject returns a not found error for missing chunks whatever the driver reports,
+// the chunk is looked for under each of its keys.
+func (s *StoreService) getObject(ctx context.Context, table, key string) ([]byte, error) {
+	ctx = utils.WithTable(ctx, table)
+	keys := s.keys(table, key)
+	data, err := s.store.GetObject(ctx, keys[0])
+	if nil == err && nil == data {
+		err = types.NotFound(keys[0])
+	}
+	if !types.IsNotFound(err) {
+		return data, err
+	}
+
+	for _, k := range keys[1:] {
+		if other, e := s.store.GetObject(ctx, k); nil == e && nil != other {
+			return other, nil
+		}
+	}
+	return nil, err
+}
+
+// deleteObject deletes the chunk under each of its keys, it is missing only when missing from all.
+func (s *StoreService) deleteObject(ctx context.Context, table, key string) error {
+	ctx = utils.WithTable(ctx, table)
+
+	var err, missing error
+	found := false
+	for _, k := range s.keys(table, key) {
+		switch e := s.store.DeleteObject(ctx, k); {
+		case nil == e:
+			found = true
+		case types.IsNotFound(e):
+			if nil == missing {
+				missing = e
+			}
+		case nil == err:
+			err = e
+		}
+	}
+	if nil == err && !found {
+		err = missing
+	}
+	return err
+}
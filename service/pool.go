@@ -0,0 +1,98 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/pool"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// concurrent reports whether a batch of chunks goes through the parallel paths,
+// the shared pool takes every batch.
+func (s *StoreService) concurrent(n int) bool {
+	return (nil != s.pool && n > 1) || (s.parallel > s.min && n > s.min)
+}
+
+// do runs a driver call on the shared pool when there is one, fn is not called when do returns an error.
+func (s *StoreService) do(ctx context.Context, priority pool.Priority, key string, fn func()) error {
+	if nil == s.pool {
+		fn()
+		return nil
+	}
+	return s.pool.Do(ctx, priority, tenantOf(key), fn)
+}
+
+func (s *StoreService) getChunksPool(ctx context.Context, chunks []*api.Chunk) chan *chunkResult {
+	q := make(chan *chunkResult, len(chunks))
+	g := &sync.WaitGroup{}
+
+	g.Add(len(chunks))
+	for i, c := range chunks {
+		r := &chunkResult{index: i, key: c.GetKey(), table: c.GetTableName()}
+		s.pool.Go(ctx, pool.Normal, tenantOf(r.key), func(err error) {
+			defer g.Done()
+
+			r.begin = time.Now()
+			if r.err = err; nil == err {
+				r.data, r.err = s.getObject(ctx, r.table, r.key)
+			}
+			r.end = time.Now()
+			q <- r
+		})
+	}
+	go func() {
+		g.Wait()
+		close(q)
+	}()
+
+	return q
+}
+
+func (s *StoreService) putChunkPool(ctx context.Context, log *zap.Logger, chunk *api.Chunk) (err error) {
+	if e := s.do(ctx, pool.Normal, chunk.GetKey(), func() {
+		err = s.putChunk(ctx, log, chunk)
+	}); nil != e {
+		err = e
+	}
+	return err
+}
+
+func (s *StoreService) putChunksPool(ctx context.Context, chunks []*api.Chunk, errs *chunkErrors) error {
+	g := &sync.WaitGroup{}
+	log := utils.Log(ctx, s.log)
+
+	g.Add(len(chunks))
+	for _, c := range chunks {
+		c := c
+		s.pool.Go(ctx, pool.Normal, tenantOf(c.GetKey()), func(err error) {
+			defer g.Done()
+
+			if nil == err {
+				err = s.putChunk(ctx, log, c)
+			}
+			if nil != err {
+				errs.add(c.GetKey(), err)
+			}
+		})
+	}
+	g.Wait()
+
+	err := errs.err()
+	s.print("putChunks", err, len(chunks)-errs.len(), chunks)
+
+	return err
+}
+
+func tenantOf(key string) string {
+	if info, err := types.ParseCheckId(key); nil == err {
+		return info.UserID
+	}
+	return ""
+}
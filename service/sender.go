@@ -0,0 +1,105 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+)
+
+const (
+	orderRequest    = "request"
+	orderCompletion = "completion"
+)
+
+const (
+	missingFail = "fail"
+	missingSkip = "skip"
+	missingBest = "best"
+)
+
+// sender applies the missing chunk mode to the fetched chunks of one GetChunks call:
+// fail stops at the first error, skip leaves out missing chunks and stops at other errors,
+// best sends whatever could be fetched.
+type sender struct {
+	log     *zap.Logger
+	service *StoreService
+	srv     api.GrpcStore_GetChunksServer
+	batch   *batcher
+	missing string
+	total   int
+	handled int
+	count   int
+	skipped int
+	err     error
+}
+
+func (s *StoreService) newSender(log *zap.Logger, srv api.GrpcStore_GetChunksServer, total int) *sender {
+	return &sender{
+		log:     log,
+		service: s,
+		srv:     srv,
+		batch:   newBatcher(log, srv, s.batch, s.count, s.flush),
+		missing: s.missing,
+		total:   total,
+	}
+}
+
+func (s *sender) result(r *chunkResult) error {
+	s.handled++
+
+	if nil == r.err {
+		r.err = s.service.verifyGet(s.log, r.key, r.data)
+	}
+	if nil != r.err {
+		if !s.tolerate(r.err) {
+			s.log.Error("getObject", zap.String("key", r.key), zap.Duration("latency", r.end.Sub(r.begin)), zap.Error(r.err))
+			s.err = r.err
+			return r.err
+		}
+		s.log.Warn("getObject", zap.String("key", r.key), zap.String("missing", s.missing), zap.Duration("latency", r.end.Sub(r.begin)), zap.Error(r.err))
+		s.skipped++
+		return nil
+	}
+
+	s.log.Debug("getObject", zap.String("key", r.key), zap.Int("length", len(r.data)), zap.Duration("latency", r.end.Sub(r.begin)))
+
+	if err := s.batch.add(&api.Chunk{Key: r.key, TableName: r.table, Encoded: r.data}); nil != err {
+		s.err = err
+		return err
+	}
+	s.count++
+
+	return nil
+}
+
+func (s *sender) tolerate(err error) bool {
+	switch s.missing {
+	case missingBest:
+		return true
+	case missingSkip:
+		return types.IsNotFound(err)
+	}
+	return false
+}
+
+// close flushes the pending chunks and returns the number of chunks sent,
+// chunks which were never fetched make the call fail.
+func (s *sender) close() (int, error) {
+	if err := s.batch.close(); nil == s.err {
+		s.err = err
+	}
+	if nil == s.err && s.handled < s.total {
+		if s.err = s.srv.Context().Err(); nil == s.err {
+			s.err = errors.Errorf("fetched %d of %d chunks", s.handled, s.total)
+		}
+	}
+	if s.skipped > 0 {
+		s.log.Warn("getChunks", zap.Int("skipped", s.skipped), zap.Int("total", s.total), zap.String("missing", s.missing))
+	}
+
+	return s.count, s.err
+}
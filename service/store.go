@@ -8,6 +8,7 @@ import (
 	"github.com/baidubce/bce-sdk-go/util/log"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/pool"
 	"github/vlorc/loki-grpc-storage/types"
 	"github/vlorc/loki-grpc-storage/utils"
 	"go.uber.org/zap"
@@ -21,27 +22,55 @@ import (
 type StoreService struct {
 	api.UnimplementedGrpcStoreServer
 	store    types.ObjectClient
+	index    types.IndexClient
+	tables   types.TableClient
 	level    zapcore.Level
 	log      *zap.Logger
 	parallel int
 	min      int
+	layout   string
+	table    string
+	period   time.Duration
+	batch    int
+	count    int
+	flush    time.Duration
+	order    string
+	missing  string
+	pool     *pool.Pool
+	verify   string
 }
 
 type chunkResult struct {
+	index int
 	key   string
+	table string
 	data  []byte
 	err   error
 	begin time.Time
 	end   time.Time
 }
 
-func NewStoreService(log *zap.Logger, conf *types.ChunkConfig, store types.ObjectClient) api.GrpcStoreServer {
+func NewStoreService(log *zap.Logger, conf *types.ChunkConfig, store types.ObjectClient, index types.IndexClient, tables types.TableClient) api.GrpcStoreServer {
 	s := &StoreService{
 		store:    store,
+		index:    index,
+		tables:   tables,
 		log:      log,
 		level:    types.Level(conf.Level),
 		parallel: conf.Parallel,
 		min:      conf.Min,
+		layout:   conf.Layout,
+		table:    conf.Table,
+		period:   conf.Period,
+		batch:    conf.Batch,
+		count:    conf.Count,
+		flush:    conf.Flush,
+		order:    conf.Order,
+		missing:  conf.Missing,
+		verify:   conf.Verify,
+	}
+	if conf.Workers > 0 {
+		s.pool = pool.New(conf.Workers)
 	}
 
 	go s.ping()
@@ -55,13 +84,13 @@ func (s *StoreService) PutChunks(ctx context.Context, req *api.PutChunksRequest)
 	}
 
 	var err error
-	if chunks := req.GetChunks(); s.parallel > s.min && len(chunks) > s.min {
+	if chunks := req.GetChunks(); s.concurrent(len(chunks)) {
 		err = s.putChunksParallel(ctx, chunks)
 	} else {
 		err = s.putChunks(ctx, chunks)
 	}
 
-	return &empty.Empty{}, err
+	return &empty.Empty{}, statusError(err)
 }
 
 func (s *StoreService) GetChunks(req *api.GetChunksRequest, srv api.GrpcStore_GetChunksServer) (err error) {
@@ -72,7 +101,7 @@ func (s *StoreService) GetChunks(req *api.GetChunksRequest, srv api.GrpcStore_Ge
 
 	var count int
 	chunks := req.GetChunks()
-	if s.parallel > s.min && len(chunks) > s.min {
+	if s.concurrent(len(chunks)) {
 		count, err = s.getChunksParallel(srv, chunks)
 	} else {
 		count, err = s.getChunks(srv, chunks)
@@ -80,7 +109,7 @@ func (s *StoreService) GetChunks(req *api.GetChunksRequest, srv api.GrpcStore_Ge
 
 	s.print("getChunks", err, count, chunks)
 
-	return err
+	return statusError(err)
 }
 
 func (s *StoreService) DeleteChunks(ctx context.Context, req *api.ChunkID) (*empty.Empty, error) {
@@ -88,13 +117,16 @@ func (s *StoreService) DeleteChunks(ctx context.Context, req *api.ChunkID) (*emp
 		return &empty.Empty{}, status.Errorf(codes.Unimplemented, "method DeleteChunks not implemented")
 	}
 
-	var cache [64]byte
-
 	log := utils.Log(ctx, s.log)
 	key := req.GetChunkID()
 	now := time.Now()
 
-	err := s.store.DeleteObject(ctx, utils.AppendKey(key, cache[:]))
+	var err error
+	if e := s.do(ctx, pool.Low, key, func() {
+		err = s.deleteObject(ctx, s.chunkTable(key), key)
+	}); nil != e {
+		err = e
+	}
 	if nil != err {
 		log.Error("delObject", zap.String("key", key), zap.Duration("latency", time.Now().Sub(now)), zap.Error(err))
 	} else {
@@ -103,7 +135,15 @@ func (s *StoreService) DeleteChunks(ctx context.Context, req *api.ChunkID) (*emp
 
 	s.printId("deleteChunks", err, key)
 
-	return &empty.Empty{}, err
+	return &empty.Empty{}, statusError(err)
+}
+
+// Close stops the workers, the queued calls fail with pool.ErrClosed.
+func (s *StoreService) Close() error {
+	if nil != s.pool {
+		s.pool.Close()
+	}
+	return nil
 }
 
 func (s *StoreService) ping() {
@@ -144,94 +184,98 @@ func (s *StoreService) print(msg string, err error, count int, chunks []*api.Chu
 }
 
 func (s *StoreService) getChunks(srv api.GrpcStore_GetChunksServer, chunks []*api.Chunk) (int, error) {
-	var last error
-	var cache [64]byte
-
 	ctx := srv.Context()
 	log := utils.Log(ctx, s.log)
-	count := 0
-
-	for _, c := range chunks {
-		r := &chunkResult{key: c.GetKey(), begin: time.Now()}
-		r.data, r.err = s.store.GetObject(ctx, utils.AppendKey(r.key, cache[:]))
+	send := s.newSender(log, srv, len(chunks))
+
+	for i, c := range chunks {
+		r := &chunkResult{index: i, key: c.GetKey(), table: c.GetTableName(), begin: time.Now()}
+		if err := s.do(ctx, pool.Normal, r.key, func() {
+			r.data, r.err = s.getObject(ctx, r.table, r.key)
+		}); nil != err {
+			r.err = err
+		}
 		r.end = time.Now()
-		if err := s.sendChunk(log, srv, r); nil != err {
-			last = err
-		} else {
-			count++
+		if err := send.result(r); nil != err {
+			break
 		}
 	}
 
-	return count, last
+	return send.close()
 }
 
 func (s *StoreService) getChunksParallel(srv api.GrpcStore_GetChunksServer, chunks []*api.Chunk) (int, error) {
-	w := make(chan string)
-	q := make(chan *chunkResult, s.parallel)
-	g := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(srv.Context())
+	defer cancel()
 
-	g.Add(s.parallel)
-	go __wait(chunks, w, q, g)
+	var q chan *chunkResult
+	if nil != s.pool {
+		q = s.getChunksPool(ctx, chunks)
+	} else {
+		w := make(chan *chunkResult)
+		g := &sync.WaitGroup{}
+		q = make(chan *chunkResult, s.parallel)
 
-	ctx := srv.Context()
-	for i := 0; i < s.parallel; i++ {
-		go s.getChunkWork(ctx, w, q, g)
+		g.Add(s.parallel)
+		go __wait(ctx, chunks, w, q, g)
+
+		for i := 0; i < s.parallel; i++ {
+			go s.getChunkWork(ctx, w, q, g)
+		}
 	}
 
-	var last error
 	log := utils.Log(ctx, s.log)
-	count := 0
+	send := s.newSender(log, srv, len(chunks))
 
+	var pending []*chunkResult
+	if orderRequest == s.order {
+		pending = make([]*chunkResult, len(chunks))
+	}
+
+	next := 0
 	for r := range q {
-		if err := s.sendChunk(log, srv, r); nil != err {
-			last = err
-		} else {
-			count++
+		if nil != send.err {
+			// drain the workers, the remaining fetches are cancelled
+			continue
+		}
+		if nil == pending {
+			if err := send.result(r); nil != err {
+				cancel()
+			}
+			continue
+		}
+		for pending[r.index] = r; next < len(pending) && nil != pending[next]; next++ {
+			if err := send.result(pending[next]); nil != err {
+				cancel()
+				break
+			}
+			pending[next] = nil
 		}
 	}
 
-	return count, last
+	return send.close()
 }
 
-func (s *StoreService) getChunkWork(ctx context.Context, queue chan string, result chan *chunkResult, group *sync.WaitGroup) {
+func (s *StoreService) getChunkWork(ctx context.Context, queue chan *chunkResult, result chan *chunkResult, group *sync.WaitGroup) {
 	defer group.Done()
 
-	var cache [64]byte
-
-	for key := range queue {
-		r := &chunkResult{
-			key:   key,
-			begin: time.Now(),
-		}
-		r.data, r.err = s.store.GetObject(ctx, utils.AppendKey(key, cache[:]))
+	for r := range queue {
+		r.begin = time.Now()
+		r.data, r.err = s.getObject(ctx, r.table, r.key)
 		r.end = time.Now()
 		result <- r
 	}
 }
 
-func (s *StoreService) sendChunk(log *zap.Logger, srv api.GrpcStore_GetChunksServer, r *chunkResult) error {
-	if nil != r.err {
-		log.Error("getObject", zap.String("key", r.key), zap.Int("length", len(r.data)), zap.Duration("latency", r.end.Sub(r.begin)), zap.Error(r.err))
-		return r.err
-	}
-
-	log.Debug("getObject", zap.String("key", r.key), zap.Int("length", len(r.data)), zap.Duration("latency", r.end.Sub(r.begin)))
-
-	if nil != srv {
-		now := time.Now()
-		if err := srv.Send(&api.GetChunksResponse{Chunks: []*api.Chunk{{Key: r.key, Encoded: r.data}}}); nil != err {
-			log.Error("sendObject", zap.String("key", r.key), zap.Int("length", len(r.data)), zap.Duration("latency", time.Now().Sub(now)), zap.Error(err))
-			return err
+func __wait(ctx context.Context, chunks []*api.Chunk, work chan *chunkResult, queue chan *chunkResult, group *sync.WaitGroup) {
+	for i, c := range chunks {
+		r := &chunkResult{index: i, key: c.GetKey(), table: c.GetTableName()}
+		select {
+		case work <- r:
+			continue
+		case <-ctx.Done():
 		}
-		log.Debug("sendObject", zap.String("key", r.key), zap.Int("length", len(r.data)), zap.Duration("latency", time.Now().Sub(now)))
-	}
-
-	return nil
-}
-
-func __wait(chunks []*api.Chunk, work chan string, queue chan *chunkResult, group *sync.WaitGroup) {
-	for _, c := range chunks {
-		work <- c.GetKey()
+		break
 	}
 	close(work)
 	group.Wait()
@@ -239,31 +283,38 @@ func __wait(chunks []*api.Chunk, work chan string, queue chan *chunkResult, grou
 }
 
 func (s *StoreService) putChunks(ctx context.Context, chunks []*api.Chunk) error {
-	var last error
+	errs := &chunkErrors{}
 
 	log := utils.Log(ctx, s.log)
 	count := 0
 
-	for _, c := range chunks {
-		if err := s.putChunk(ctx, log, c); nil != err {
-			last = err
+	for i, c := range chunks {
+		if err := ctx.Err(); nil != err {
+			errs.skip(chunks[i:], err)
+			break
+		}
+		if err := s.putChunkPool(ctx, log, c); nil != err {
+			errs.add(c.GetKey(), err)
 		} else {
 			count++
 		}
 	}
 
-	s.print("putChunks", last, count, chunks)
+	err := errs.err()
+	s.print("putChunks", err, count, chunks)
 
-	return last
+	return err
 }
 
 func (s *StoreService) putChunk(ctx context.Context, log *zap.Logger, chunk *api.Chunk) error {
-	var cache [64]byte
-
 	key := chunk.GetKey()
 	buf := chunk.GetEncoded()
+	if err := s.verifyPut(log, key, buf); nil != err {
+		return err
+	}
+
 	now := time.Now()
-	err := s.store.PutObject(ctx, utils.AppendKey(key, cache[:]), buf)
+	err := s.store.PutObject(utils.WithTable(ctx, chunk.GetTableName()), s.objectKey(chunk.GetTableName(), key), buf)
 	if nil != err {
 		log.Error("putObject", zap.String("key", key), zap.Int("length", len(buf)), zap.Duration("latency", time.Now().Sub(now)), zap.Error(err))
 	} else {
@@ -273,31 +324,57 @@ func (s *StoreService) putChunk(ctx context.Context, log *zap.Logger, chunk *api
 	return err
 }
 
-func (s *StoreService) putChunkWork(ctx context.Context, chunks chan *api.Chunk, group *sync.WaitGroup) {
+func (s *StoreService) putChunkWork(ctx context.Context, chunks chan *api.Chunk, errs *chunkErrors, group *sync.WaitGroup) {
 	defer group.Done()
 
 	log := utils.Log(ctx, s.log)
 
 	for c := range chunks {
-		_ = s.putChunk(ctx, log, c)
+		err := ctx.Err()
+		if nil == err {
+			err = s.putChunk(ctx, log, c)
+		}
+		if nil != err {
+			errs.add(c.GetKey(), err)
+		}
 	}
 }
 
+// putChunksParallel writes the chunks with at most parallel uploads and waits for all of them,
+// chunks which were not started before the context is done are reported as failed.
 func (s *StoreService) putChunksParallel(ctx context.Context, chunks []*api.Chunk) error {
 	w := make(chan *api.Chunk)
 	g := &sync.WaitGroup{}
+	errs := &chunkErrors{}
 
-	g.Add(s.parallel)
-	go func() {
-		for _, c := range chunks {
-			w <- c
-		}
-		close(w)
-	}()
+	if nil != s.pool {
+		return s.putChunksPool(ctx, chunks, errs)
+	}
 
-	for i := 0; i < s.parallel; i++ {
-		go s.putChunkWork(ctx, w, g)
+	parallel := s.parallel
+	if parallel > len(chunks) {
+		parallel = len(chunks)
 	}
 
-	return nil
+	g.Add(parallel)
+	for i := 0; i < parallel; i++ {
+		go s.putChunkWork(ctx, w, errs, g)
+	}
+
+	for i, c := range chunks {
+		select {
+		case w <- c:
+			continue
+		case <-ctx.Done():
+			errs.skip(chunks[i:], ctx.Err())
+		}
+		break
+	}
+	close(w)
+	g.Wait()
+
+	err := errs.err()
+	s.print("putChunks", err, len(chunks)-errs.len(), chunks)
+
+	return err
 }
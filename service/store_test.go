@@ -0,0 +1,347 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/driver/memory"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type __store struct {
+	lock sync.Mutex
+	data map[string][]byte
+}
+
+func (s *__store) PutObject(ctx context.Context, key string, data []byte) error {
+	if strings.Contains(key, "bad") {
+		return types.NewError(types.KindUnavailable, key, errors.New("fake unavailable"))
+	}
+	s.lock.Lock()
+	s.data[key] = data
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *__store) GetObject(ctx context.Context, key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if data, ok := s.data[key]; ok {
+		return data, nil
+	}
+	return nil, types.NotFound(key)
+}
+
+func (s *__store) DeleteObject(ctx context.Context, key string) error {
+	s.lock.Lock()
+	delete(s.data, key)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *__store) Ping() error {
+	return nil
+}
+
+type __stream struct {
+	grpc.ServerStream
+	lock      sync.Mutex
+	responses []*api.GetChunksResponse
+}
+
+func (s *__stream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *__stream) Send(resp *api.GetChunksResponse) error {
+	s.lock.Lock()
+	s.responses = append(s.responses, resp)
+	s.lock.Unlock()
+	return nil
+}
+
+func __service(store types.ObjectClient, parallel int) api.GrpcStoreServer {
+	log, _ := zap.NewDevelopment()
+	return NewStoreService(log, &types.ChunkConfig{Parallel: parallel, Min: 1, Count: 3, Flush: time.Second}, store, nil, nil)
+}
+
+func __chunks(keys ...string) []*api.Chunk {
+	chunks := make([]*api.Chunk, len(keys))
+	for i, k := range keys {
+		chunks[i] = &api.Chunk{Key: "fake/" + k, Encoded: []byte(k)}
+	}
+	return chunks
+}
+
+func __failed(err error) []string {
+	var keys []string
+	for _, d := range status.Convert(err).Details() {
+		if r, ok := d.(*errdetails.ResourceInfo); ok {
+			keys = append(keys, r.ResourceName)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestStoreService_PutChunks(t *testing.T) {
+	for _, parallel := range []int{0, 4} {
+		store := &__store{data: map[string][]byte{}}
+		chunks := __chunks("a", "bad1", "b", "c", "bad2", "d")
+
+		_, err := __service(store, parallel).PutChunks(context.Background(), &api.PutChunksRequest{Chunks: chunks})
+		if status.Code(err) != codes.Unavailable {
+			t.Error("putChunks code failed", parallel, err)
+		}
+		if keys := __failed(err); len(keys) != 2 || keys[0] != "fake/bad1" || keys[1] != "fake/bad2" {
+			t.Error("putChunks details failed", parallel, keys)
+		}
+		if len(store.data) != 4 {
+			t.Error("putChunks not awaited", parallel, len(store.data))
+		}
+	}
+}
+
+func TestStoreService_PutChunksCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	chunks := __chunks("a", "b", "c", "d")
+	_, err := __service(&__store{data: map[string][]byte{}}, 2).PutChunks(ctx, &api.PutChunksRequest{Chunks: chunks})
+	if status.Code(err) != codes.Canceled || len(__failed(err)) != len(chunks) {
+		t.Error("putChunks cancel failed", err)
+	}
+}
+
+func TestStoreService_GetChunks(t *testing.T) {
+	for _, parallel := range []int{0, 4} {
+		store := &__store{data: map[string][]byte{}}
+		chunks := __chunks("a", "b", "c", "d", "e", "f", "g")
+		if _, err := __service(store, 0).PutChunks(context.Background(), &api.PutChunksRequest{Chunks: chunks}); nil != err {
+			t.Fatal("putChunks failed", err.Error())
+		}
+
+		srv := &__stream{}
+		if err := __service(store, parallel).GetChunks(&api.GetChunksRequest{Chunks: chunks}, srv); nil != err {
+			t.Error("getChunks failed", parallel, err.Error())
+		}
+		total := 0
+		for _, resp := range srv.responses {
+			total += len(resp.Chunks)
+		}
+		if len(srv.responses) != 3 || total != len(chunks) {
+			t.Error("getChunks batch failed", parallel, len(srv.responses), total)
+		}
+	}
+}
+
+func TestBatcher_Flush(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	srv := &__stream{}
+	b := newBatcher(log, srv, 1<<10, 16, 10*time.Millisecond)
+
+	if err := b.add(&api.Chunk{Key: "fake/a", Encoded: make([]byte, 600)}); nil != err {
+		t.Fatal("add failed", err.Error())
+	}
+	if err := b.add(&api.Chunk{Key: "fake/b", Encoded: make([]byte, 600)}); nil != err {
+		t.Fatal("add failed", err.Error())
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	srv.lock.Lock()
+	count := len(srv.responses)
+	srv.lock.Unlock()
+	if count != 2 {
+		t.Error("flush failed", count)
+	}
+	if err := b.close(); nil != err || len(srv.responses) != 2 {
+		t.Error("close failed", err, len(srv.responses))
+	}
+}
+
+func TestStoreService_GetChunksMissing(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := &__store{data: map[string][]byte{}}
+	chunks := __chunks("a", "b", "c", "d", "e", "f", "g", "h")
+	if _, err := __service(store, 0).PutChunks(context.Background(), &api.PutChunksRequest{Chunks: chunks}); nil != err {
+		t.Fatal("putChunks failed", err.Error())
+	}
+	_ = store.DeleteObject(context.Background(), "fake/c")
+
+	cases := map[string]codes.Code{missingFail: codes.NotFound, missingSkip: codes.OK, missingBest: codes.OK}
+	for missing, code := range cases {
+		for _, parallel := range []int{0, 4, -1} {
+			conf := &types.ChunkConfig{Parallel: parallel, Min: 1, Count: 1, Order: orderRequest, Missing: missing}
+			if parallel < 0 {
+				conf.Workers = 2
+			}
+			srv := &__stream{}
+			err := NewStoreService(log, conf, store, nil, nil).GetChunks(&api.GetChunksRequest{Chunks: chunks}, srv)
+			if status.Code(err) != code {
+				t.Error("getChunks code failed", missing, parallel, err)
+			}
+			if codes.OK != code {
+				continue
+			}
+
+			var keys []string
+			for _, resp := range srv.responses {
+				for _, c := range resp.Chunks {
+					keys = append(keys, c.Key)
+				}
+			}
+			if strings.Join(keys, ",") != "fake/a,fake/b,fake/d,fake/e,fake/f,fake/g,fake/h" {
+				t.Error("getChunks order failed", missing, parallel, keys)
+			}
+		}
+	}
+}
+
+func TestStoreService_Checksum(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := &__store{data: map[string][]byte{}}
+	conf := &types.ChunkConfig{Count: 1, Verify: verifyEnforce}
+	s := NewStoreService(log, conf, store, nil, nil)
+	puts, gets := __counter("put_mismatch"), __counter("get_mismatch")
+
+	data := []byte("encoded chunk")
+	key := fmt.Sprintf("fake/a70ecbaeaa65a26a:17ab9b3875f:17ab9b3889b:%x", crc32.Checksum(data, castagnoli))
+	if _, err := s.PutChunks(context.Background(), &api.PutChunksRequest{Chunks: []*api.Chunk{{Key: key, Encoded: data}}}); nil != err {
+		t.Fatal("putChunks failed", err.Error())
+	}
+	_, err := s.PutChunks(context.Background(), &api.PutChunksRequest{Chunks: []*api.Chunk{{Key: key, Encoded: data[1:]}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Error("putChunks corrupt failed", err)
+	}
+
+	for k := range store.data {
+		store.data[k] = data[:4]
+	}
+	err = s.GetChunks(&api.GetChunksRequest{Chunks: []*api.Chunk{{Key: key}}}, &__stream{})
+	if status.Code(err) != codes.DataLoss {
+		t.Error("getChunks corrupt failed", err)
+	}
+	if __counter("put_mismatch") != puts+1 || __counter("get_mismatch") != gets+1 {
+		t.Error("checksum stats failed", checksums.String())
+	}
+}
+
+func __counter(name string) int64 {
+	if v, ok := checksums.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestChunkDropper_Unlisted(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	drop := ChunkDropper(log, &types.ChunkConfig{Layout: layoutTable}, &__store{data: map[string][]byte{}})
+	if err := drop(context.Background(), "chunks_2650"); nil == err {
+		t.Error("drop without listing succeeded")
+	}
+}
+
+type __listed struct {
+	__store
+}
+
+func (s *__listed) ListObjects(ctx context.Context, prefix, after string, limit int) ([]types.ObjectInfo, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var objects []types.ObjectInfo
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			objects = append(objects, types.ObjectInfo{Key: k})
+		}
+	}
+	return objects, "", nil
+}
+
+func TestChunkDropper_Flat(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := &__listed{__store{data: map[string][]byte{}}}
+	conf := &types.ChunkConfig{Layout: layoutFlat, Table: "chunks_", Period: 24 * time.Hour}
+
+	id := "fake/a70ecbaeaa65a26a:17ab9b3875f:17ab9b3889b:d8c9fe60"
+	other := "fake/a70ecbaeaa65a26a:17ab4b3875f:17ab4b3889b:d8c9fe60"
+	table := types.PeriodicTable{Prefix: "chunks_", Period: 24 * time.Hour}.Name(time.Unix(0, 0x17ab9b3875f*int64(time.Millisecond)))
+	keys := []string{utils.FormatKey(id), utils.FormatKey(other), "index/" + table + "/manifest"}
+	for _, k := range keys {
+		store.PutObject(context.Background(), k, []byte("cccc"))
+	}
+
+	drop := ChunkDropper(log, conf, store)
+	for _, name := range []string{table, "index_" + table[len("chunks_"):]} {
+		if err := drop(context.Background(), name); nil != err {
+			t.Fatal("drop failed", name, err.Error())
+		}
+	}
+	for i, k := range keys {
+		if _, ok := store.data[k]; ok != (0 != i) {
+			t.Error("drop failed", k, ok)
+		}
+	}
+}
+
+func TestStoreService_DeleteChunks(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := &__store{data: map[string][]byte{}}
+	conf := &types.ChunkConfig{Layout: layoutTable, Table: "chunks_", Period: 24 * time.Hour, Min: 1}
+	s := NewStoreService(log, conf, store, nil, nil)
+
+	id := "fake/a70ecbaeaa65a26a:17ab9b3875f:17ab9b3889b:d8c9fe60"
+	table := types.PeriodicTable{Prefix: "chunks_", Period: 24 * time.Hour}.Name(time.Unix(0, 0x17ab9b3875f*int64(time.Millisecond)))
+	keys := []string{table + "/" + utils.FormatKey(id), utils.FormatKey(id), "chunks_1/" + utils.FormatKey(id)}
+	for _, k := range keys {
+		store.PutObject(context.Background(), k, []byte("cccc"))
+	}
+
+	if _, err := s.DeleteChunks(context.Background(), &api.ChunkID{ChunkID: id}); nil != err {
+		t.Fatal("deleteChunks failed", err.Error())
+	}
+	for i, k := range keys {
+		if _, ok := store.data[k]; ok != (2 == i) {
+			t.Error("deleteChunks failed", k, ok)
+		}
+	}
+}
+
+func TestStoreService_LegacyKey(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	store := memory.New(log, &types.StoreConfig{Driver: "memory"})
+	s := NewStoreService(log, &types.ChunkConfig{Layout: layoutFlat, Min: 1}, store, nil, nil).(*StoreService)
+
+	id := "team:a/a70e_cbae:17ab9b3875f"
+	store.PutObject(context.Background(), utils.LegacyKey(id), []byte("cccc"))
+
+	if data, err := s.getObject(context.Background(), "", id); nil != err || "cccc" != string(data) {
+		t.Error("legacy getObject failed", err)
+	}
+	if err := s.deleteObject(context.Background(), "", id); nil != err {
+		t.Error("legacy deleteObject failed", err)
+	}
+	if _, err := store.GetObject(context.Background(), utils.LegacyKey(id)); !types.IsNotFound(err) {
+		t.Error("legacy object kept", err)
+	}
+	if err := s.deleteObject(context.Background(), "", id); !types.IsNotFound(err) {
+		t.Error("missing deleteObject failed", err)
+	}
+}
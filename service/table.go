@@ -0,0 +1,141 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+func (s *StoreService) ListTables(ctx context.Context, _ *empty.Empty) (*api.ListTablesResponse, error) {
+	if nil == s.tables {
+		return nil, status.Errorf(codes.Unimplemented, "method ListTables not implemented")
+	}
+
+	names, err := s.tables.ListTables(ctx)
+	if nil != err {
+		utils.Log(ctx, s.log).Error("listTables", zap.Error(err))
+		return nil, statusError(err)
+	}
+
+	return &api.ListTablesResponse{TableNames: names}, nil
+}
+
+func (s *StoreService) CreateTable(ctx context.Context, req *api.CreateTableRequest) (*empty.Empty, error) {
+	if nil == s.tables {
+		return &empty.Empty{}, status.Errorf(codes.Unimplemented, "method CreateTable not implemented")
+	}
+
+	err := s.tables.CreateTable(ctx, req.GetDesc())
+	s.printTable(ctx, "createTable", req.GetDesc().GetName(), err)
+
+	return &empty.Empty{}, statusError(err)
+}
+
+func (s *StoreService) DeleteTable(ctx context.Context, req *api.DeleteTableRequest) (*empty.Empty, error) {
+	if nil == s.tables {
+		return &empty.Empty{}, status.Errorf(codes.Unimplemented, "method DeleteTable not implemented")
+	}
+
+	err := s.tables.DeleteTable(ctx, req.GetTableName())
+	s.printTable(ctx, "deleteTable", req.GetTableName(), err)
+
+	return &empty.Empty{}, statusError(err)
+}
+
+func (s *StoreService) DescribeTable(ctx context.Context, req *api.DescribeTableRequest) (*api.DescribeTableResponse, error) {
+	if nil == s.tables {
+		return nil, status.Errorf(codes.Unimplemented, "method DescribeTable not implemented")
+	}
+
+	desc, ok, err := s.tables.DescribeTable(ctx, req.GetTableName())
+	if nil != err {
+		s.printTable(ctx, "describeTable", req.GetTableName(), err)
+		return nil, statusError(err)
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "table %s not found", req.GetTableName())
+	}
+
+	return &api.DescribeTableResponse{Desc: desc, IsActive: true}, nil
+}
+
+func (s *StoreService) UpdateTable(ctx context.Context, req *api.UpdateTableRequest) (*empty.Empty, error) {
+	if nil == s.tables {
+		return &empty.Empty{}, status.Errorf(codes.Unimplemented, "method UpdateTable not implemented")
+	}
+
+	err := s.tables.UpdateTable(ctx, req.GetCurrent(), req.GetExpected())
+	s.printTable(ctx, "updateTable", req.GetExpected().GetName(), err)
+
+	return &empty.Empty{}, statusError(err)
+}
+
+func (s *StoreService) printTable(ctx context.Context, msg string, name string, err error) {
+	log := utils.Log(ctx, s.log)
+	if nil != err {
+		log.Error(msg, zap.String("table", name), zap.Error(err))
+	} else {
+		log.Info(msg, zap.String("table", name))
+	}
+}
+
+// ChunkDropper removes the chunk objects of a table, stored under its prefix with the table layout
+// and found by the period of their from time among the flat keys otherwise, which takes a listing
+// of the whole store. Stores which can not list refuse the drop.
+func ChunkDropper(log *zap.Logger, conf *types.ChunkConfig, store types.ObjectClient) func(context.Context, string) error {
+	periodic := types.PeriodicTable{Prefix: conf.Table, Period: conf.Period}
+
+	return func(ctx context.Context, name string) error {
+		if "" == name {
+			return nil
+		}
+
+		prefix, match := name+"/", func(string) bool { return true }
+		if layoutTable != conf.Layout {
+			if _, _, ok := periodic.Parse(name); !ok || "" == periodic.Prefix {
+				// not a chunk table, such as the index tables
+				return nil
+			}
+			prefix, match = "", func(key string) bool {
+				info, err := types.ParseCheckId(utils.ParseKey(key))
+				return nil == err && strings.Count(key, "/") <= 1 && periodic.Name(info.From) == name
+			}
+		}
+
+		// without a listing the chunks can not be found, the table is kept rather than leaking them
+		lister, err := types.Lister(store)
+		if nil != err {
+			log.Error("drop chunks", zap.String("table", name), zap.Error(err))
+			return err
+		}
+
+		count := 0
+		ctx = utils.WithTable(ctx, name)
+		err = types.WalkObjects(ctx, lister, prefix, 1000, func(o types.ObjectInfo) error {
+			if !match(o.Key) {
+				return nil
+			}
+			if err := store.DeleteObject(ctx, o.Key); nil != err && !types.IsNotFound(err) {
+				return err
+			}
+			count++
+			return nil
+		})
+		if nil != err {
+			log.Error("drop chunks", zap.String("table", name), zap.Int("count", count), zap.Error(err))
+			return err
+		}
+		log.Info("drop chunks", zap.String("table", name), zap.Int("count", count))
+
+		return nil
+	}
+}
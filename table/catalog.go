@@ -0,0 +1,153 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+)
+
+type storage interface {
+	load(ctx context.Context) ([]byte, error)
+	save(ctx context.Context, buf []byte) error
+}
+
+// Catalog keeps table descriptions in memory and persists the whole set on every change.
+type Catalog struct {
+	log     *zap.Logger
+	mtx     sync.RWMutex
+	tables  map[string]*api.TableDesc
+	storage storage
+	cascade []func(context.Context, string) error
+}
+
+var _ types.TableClient = &Catalog{}
+
+func newCatalog(log *zap.Logger, storage storage, cascade ...func(context.Context, string) error) *Catalog {
+	c := &Catalog{
+		log:     log,
+		tables:  map[string]*api.TableDesc{},
+		storage: storage,
+		cascade: cascade,
+	}
+
+	// the table manager of loki recreates missing tables on every sync,
+	// so an unreadable catalog only costs one sync period
+	buf, err := storage.load(context.Background())
+	if nil != err {
+		log.Warn("load catalog", zap.Error(err))
+		return c
+	}
+	if len(buf) > 0 {
+		var tables []*api.TableDesc
+		if err = json.Unmarshal(buf, &tables); nil != err {
+			log.Warn("invalid catalog", zap.Error(err))
+			return c
+		}
+		for _, t := range tables {
+			c.tables[t.GetName()] = t
+		}
+	}
+	log.Debug("load catalog", zap.Int("count", len(c.tables)))
+
+	return c
+}
+
+func (c *Catalog) ListTables(ctx context.Context) ([]string, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	names := make([]string, 0, len(c.tables))
+	for name := range c.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (c *Catalog) CreateTable(ctx context.Context, desc *api.TableDesc) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tables := c.clone()
+	tables[desc.GetName()] = desc
+
+	return c.persist(ctx, tables)
+}
+
+func (c *Catalog) DeleteTable(ctx context.Context, name string) error {
+	for _, drop := range c.cascade {
+		if err := drop(ctx, name); nil != err {
+			return err
+		}
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.tables[name]; !ok {
+		return nil
+	}
+	tables := c.clone()
+	delete(tables, name)
+
+	return c.persist(ctx, tables)
+}
+
+func (c *Catalog) DescribeTable(ctx context.Context, name string) (*api.TableDesc, bool, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	desc, ok := c.tables[name]
+	return desc, ok, nil
+}
+
+func (c *Catalog) UpdateTable(ctx context.Context, current, expected *api.TableDesc) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tables := c.clone()
+	if name := current.GetName(); "" != name && name != expected.GetName() {
+		delete(tables, name)
+	}
+	tables[expected.GetName()] = expected
+
+	return c.persist(ctx, tables)
+}
+
+func (c *Catalog) clone() map[string]*api.TableDesc {
+	tables := make(map[string]*api.TableDesc, len(c.tables)+1)
+	for name, t := range c.tables {
+		tables[name] = t
+	}
+	return tables
+}
+
+// persist saves the tables and only then makes them current, a failed save changes nothing.
+func (c *Catalog) persist(ctx context.Context, tables map[string]*api.TableDesc) error {
+	list := make([]*api.TableDesc, 0, len(tables))
+	for _, t := range tables {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].GetName() < list[j].GetName()
+	})
+
+	buf, err := json.Marshal(list)
+	if nil != err {
+		return err
+	}
+	if err = c.storage.save(ctx, buf); nil != err {
+		return err
+	}
+	c.tables = tables
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package table
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/api"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCatalog_Table(t *testing.T) {
+	dir, err := ioutil.TempDir("", "table")
+	if nil != err {
+		t.Fatal("tempDir failed", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	var dropped []string
+	log, _ := zap.NewDevelopment()
+	conf := &types.TableConfig{Driver: "file", Url: dir, Key: "tables.json"}
+	c := New(log, conf, nil, func(ctx context.Context, name string) error {
+		dropped = append(dropped, name)
+		return nil
+	})
+
+	desc := &api.TableDesc{Name: "index_2650", ProvisionedRead: 1, Tags: map[string]string{"env": "dev"}}
+	if err := c.CreateTable(context.Background(), desc); nil != err {
+		t.Error("createTable failed", err.Error())
+	}
+	if err := c.CreateTable(context.Background(), &api.TableDesc{Name: "index_2651"}); nil != err {
+		t.Error("createTable failed", err.Error())
+	}
+	if err := c.UpdateTable(context.Background(), desc, &api.TableDesc{Name: "index_2650", ProvisionedRead: 2}); nil != err {
+		t.Error("updateTable failed", err.Error())
+	}
+
+	reload := New(log, conf, nil)
+	if names, _ := reload.ListTables(context.Background()); len(names) != 2 {
+		t.Error("listTables failed", names)
+	}
+	if d, ok, _ := reload.DescribeTable(context.Background(), "index_2650"); !ok || d.ProvisionedRead != 2 {
+		t.Error("describeTable failed", d)
+	}
+
+	if err := c.DeleteTable(context.Background(), "index_2651"); nil != err {
+		t.Error("deleteTable failed", err.Error())
+	}
+	if len(dropped) != 1 || dropped[0] != "index_2651" {
+		t.Error("cascade failed", dropped)
+	}
+	if _, ok, _ := New(log, conf, nil).DescribeTable(context.Background(), "index_2651"); ok {
+		t.Error("deleteTable not persisted")
+	}
+}
+
+type __storage struct {
+	err error
+}
+
+func (s *__storage) load(ctx context.Context) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *__storage) save(ctx context.Context, buf []byte) error {
+	return s.err
+}
+
+func TestCatalog_Persist(t *testing.T) {
+	log, _ := zap.NewDevelopment()
+	storage := &__storage{}
+	c := newCatalog(log, storage)
+	if err := c.CreateTable(context.Background(), &api.TableDesc{Name: "index_2650"}); nil != err {
+		t.Fatal("createTable failed", err.Error())
+	}
+
+	storage.err = errors.New("fake unavailable")
+	if err := c.CreateTable(context.Background(), &api.TableDesc{Name: "index_2651"}); nil == err {
+		t.Error("createTable not failed")
+	}
+	if err := c.UpdateTable(context.Background(), &api.TableDesc{Name: "index_2650"}, &api.TableDesc{Name: "index_2650", ProvisionedRead: 2}); nil == err {
+		t.Error("updateTable not failed")
+	}
+	if err := c.DeleteTable(context.Background(), "index_2650"); nil == err {
+		t.Error("deleteTable not failed")
+	}
+
+	if names, _ := c.ListTables(context.Background()); len(names) != 1 {
+		t.Error("failed change applied", names)
+	}
+	if d, ok, _ := c.DescribeTable(context.Background(), "index_2650"); !ok || d.ProvisionedRead != 0 {
+		t.Error("failed update applied", d)
+	}
+}
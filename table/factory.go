@@ -0,0 +1,31 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package table
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+)
+
+var table = map[string]func(*zap.Logger, *types.TableConfig, types.ObjectClient, ...func(context.Context, string) error) (types.TableClient, error){
+	"file":   File,
+	"object": Object,
+}
+
+func New(log *zap.Logger, config *types.TableConfig, store types.ObjectClient, cascade ...func(context.Context, string) error) types.TableClient {
+	t, err := Factory(log, config, store, cascade...)
+	if nil != err {
+		panic(err)
+	}
+	return t
+}
+
+func Factory(log *zap.Logger, config *types.TableConfig, store types.ObjectClient, cascade ...func(context.Context, string) error) (types.TableClient, error) {
+	if factory, ok := table[config.Driver]; ok {
+		return factory(log.With(zap.String("table", config.Driver)), config, store, cascade...)
+	}
+	return nil, errors.Errorf("can not support table '%s'", config.Driver)
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package table
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/types"
+	"github/vlorc/loki-grpc-storage/utils"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+)
+
+type file struct {
+	path string
+}
+
+func File(log *zap.Logger, config *types.TableConfig, _ types.ObjectClient, cascade ...func(context.Context, string) error) (types.TableClient, error) {
+	root, err := filepath.Abs(filepath.Clean(config.Url))
+	if nil != err {
+		return nil, err
+	}
+	if err = os.MkdirAll(root, 0755); nil != err {
+		return nil, err
+	}
+
+	return newCatalog(log, &file{path: filepath.Join(root, config.Key)}, cascade...), nil
+}
+
+func (f *file) load(ctx context.Context) ([]byte, error) {
+	buf, err := utils.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return buf, err
+}
+
+func (f *file) save(ctx context.Context, buf []byte) error {
+	tmp := f.path + ".tmp"
+	if err := utils.WriteFile(tmp, buf); nil != err {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package table
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github/vlorc/loki-grpc-storage/types"
+	"go.uber.org/zap"
+)
+
+type object struct {
+	key   string
+	store types.ObjectClient
+}
+
+func Object(log *zap.Logger, config *types.TableConfig, store types.ObjectClient, cascade ...func(context.Context, string) error) (types.TableClient, error) {
+	if nil == store {
+		return nil, errors.New("table object catalog requires an object store")
+	}
+
+	return newCatalog(log, &object{key: config.Key, store: store}, cascade...), nil
+}
+
+func (o *object) load(ctx context.Context) ([]byte, error) {
+	buf, err := o.store.GetObject(ctx, o.key)
+	if types.IsNotFound(err) {
+		return nil, nil
+	}
+	return buf, err
+}
+
+func (o *object) save(ctx context.Context, buf []byte) error {
+	return o.store.PutObject(ctx, o.key, buf)
+}
@@ -18,6 +18,63 @@ type ObjectClient interface {
 	Ping() error
 }
 
+type ObjectInfo struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+	Checksum string
+}
+
+// ObjectLister is implemented by drivers able to enumerate their objects, it returns up to limit
+// objects after the given continuation and the continuation of the next page, empty after the last one.
+// Continuations are opaque, only those returned by the driver may be given back.
+type ObjectLister interface {
+	ListObjects(ctx context.Context, prefix, after string, limit int) ([]ObjectInfo, string, error)
+}
+
+// ObjectStater is implemented by drivers able to describe an object without downloading it,
+// a missing object is reported by an error matching IsNotFound.
+type ObjectStater interface {
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+var ErrUnsupported = errors.New("unsupported capability")
+
+// Lister returns the listing capability of a driver or ErrUnsupported.
+func Lister(client ObjectClient) (ObjectLister, error) {
+	if l, ok := client.(ObjectLister); ok {
+		return l, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// Stater returns the stat capability of a driver or ErrUnsupported.
+func Stater(client ObjectClient) (ObjectStater, error) {
+	if s, ok := client.(ObjectStater); ok {
+		return s, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// WalkObjects visits every object under the prefix page by page.
+func WalkObjects(ctx context.Context, lister ObjectLister, prefix string, limit int, visit func(ObjectInfo) error) error {
+	for after := ""; ; {
+		objects, next, err := lister.ListObjects(ctx, prefix, after, limit)
+		if nil != err {
+			return err
+		}
+		for _, o := range objects {
+			if err = visit(o); nil != err {
+				return err
+			}
+		}
+		if "" == next {
+			return nil
+		}
+		after = next
+	}
+}
+
 func errInvalidChunkID(s string) error {
 	return errors.Errorf("invalid chunk ID %q", s)
 }
@@ -52,8 +109,8 @@ func ParseCheckId(key string) (*CheckInfo, error) {
 		Id:          key,
 		UserID:      userID,
 		Fingerprint: fingerprint,
-		From:        time.Unix(0, from),
-		Through:     time.Unix(0, through),
+		From:        time.Unix(0, from*int64(time.Millisecond)),
+		Through:     time.Unix(0, through*int64(time.Millisecond)),
 		Checksum:    uint32(checksum),
 		ChecksumSet: true,
 	}, nil
@@ -3,18 +3,25 @@
 
 package types
 
+import "time"
+
 const UserAgent = "storage"
 
 type Config struct {
 	Log    LogConfig    `flag:"log"`
 	Chunk  ChunkConfig  `flag:"chunk"`
 	Store  StoreConfig  `flag:"store"`
+	Index  IndexConfig  `flag:"index"`
+	Table  TableConfig  `flag:"table"`
+	Retain RetainConfig `flag:"retention"`
+	Quota  QuotaConfig  `flag:"quota"`
 	Server ServerConfig `flag:"server"`
 }
 
 type ServerConfig struct {
-	Host string `flag:"host,0.0.0.0,server host"`
-	Port string `flag:"port,5783,server port"`
+	Host  string `flag:"host,0.0.0.0,server host"`
+	Port  string `flag:"port,5783,server port"`
+	Admin string `flag:"admin,,server admin http address"`
 }
 
 type LogConfig struct {
@@ -25,22 +32,84 @@ type LogConfig struct {
 }
 
 type ChunkConfig struct {
-	Level    string `flag:"level,debug,chunk level"`
-	Mode     string `flag:"mode,prod,chunk mode"`
-	Min      int    `flag:"min,12,chunk minimum"`
-	Parallel int    `flag:"parallel,0,chunk parallel"`
+	Level    string        `flag:"level,debug,chunk level"`
+	Mode     string        `flag:"mode,prod,chunk mode"`
+	Min      int           `flag:"min,12,chunk minimum"`
+	Parallel int           `flag:"parallel,0,chunk parallel"`
+	Layout   string        `flag:"layout,flat,chunk layout"`
+	Table    string        `flag:"table,chunks_,chunk periodic table prefix"`
+	Period   time.Duration `flag:"period,168h,chunk periodic table period"`
+	Batch    int           `flag:"batch,3145728,chunk response batch bytes"`
+	Count    int           `flag:"count,64,chunk response batch count"`
+	Flush    time.Duration `flag:"flush,20ms,chunk response flush interval"`
+	Order    string        `flag:"order,completion,chunk response order"`
+	Missing  string        `flag:"missing,fail,chunk missing mode"`
+	Workers  int           `flag:"workers,0,chunk shared driver workers"`
+	Verify   string        `flag:"verify,log,chunk checksum verification"`
 }
 
 type StoreConfig struct {
-	Level  string `flag:"level,debug,store level"`
-	Mode   string `flag:"mode,prod,store mode"`
-	Driver string `flag:"driver,fs,store driver"`
-	Name   string `flag:"name,,store name"`
-	Url    string `flag:"url,{tmpdir},store url"`
-	Access string `flag:"access,,store access"`
-	Secret string `flag:"secret,,store secret"`
-	Token  string `flag:"token,,store token"`
-	Bucket string `flag:"bucket,,store bucket"`
-	Region string `flag:"region,,store region"`
-	Flag   string `flag:"flag,,store flag"`
+	Level    string        `flag:"level,debug,store level"`
+	Mode     string        `flag:"mode,prod,store mode"`
+	Driver   string        `flag:"driver,fs,store driver"`
+	Name     string        `flag:"name,,store name"`
+	Url      string        `flag:"url,{tmpdir},store url"`
+	Access   string        `flag:"access,,store access"`
+	Secret   string        `flag:"secret,,store secret"`
+	Token    string        `flag:"token,,store token"`
+	Bucket   string        `flag:"bucket,,store bucket"`
+	Region   string        `flag:"region,,store region"`
+	Flag     string        `flag:"flag,,store flag"`
+	Schema   string        `flag:"schema,legacy,store chunk key schema"`
+	Routes   string        `flag:"routes,,store routing file"`
+	Compress string        `flag:"compress,,store compression codec"`
+	Keyring  string        `flag:"keyring,,store encryption keyring file"`
+	Sealed   bool          `flag:"sealed,,store reject plain objects read with a keyring"`
+	Rewrap   bool          `flag:"rewrap,,store rewrap objects under the active key and exit instead of serving"`
+	Cache    int64         `flag:"cache,0,store memory cache bytes"`
+	Expire   time.Duration `flag:"expire,0s,store memory cache ttl"`
+	Disk     string        `flag:"disk,,store disk cache directory"`
+	DiskSize int64         `flag:"disksize,0,store disk cache bytes"`
+	Coalesce bool          `flag:"coalesce,,store coalesce concurrent reads of a key"`
+	Negative time.Duration `flag:"negative,0s,store missing key cache ttl"`
+	Bloom    int           `flag:"bloom,0,store bloom filter expected keys"`
+	Rescan   time.Duration `flag:"rescan,1h,store bloom filter rebuild interval"`
+}
+
+type IndexConfig struct {
+	Level  string        `flag:"level,debug,index level"`
+	Driver string        `flag:"driver,bolt,index driver"`
+	Url    string        `flag:"url,{tmpdir}/loki/index,index url"`
+	Batch  int           `flag:"batch,256,index batch"`
+	Prefix string        `flag:"prefix,index,index object prefix"`
+	Seal   time.Duration `flag:"seal,15m,index seal period"`
+	Sync   time.Duration `flag:"sync,1m,index sync period"`
+	Node   string        `flag:"node,,index node name defaulting to the host name"`
+}
+
+type TableConfig struct {
+	Driver string `flag:"driver,file,table driver"`
+	Url    string `flag:"url,{tmpdir}/loki/table,table url"`
+	Key    string `flag:"key,tables.json,table catalog key"`
+}
+
+type RetainConfig struct {
+	Period   time.Duration `flag:"period,168h,retention table period"`
+	Index    string        `flag:"index,index_,retention index table prefix"`
+	Chunk    string        `flag:"chunk,chunks_,retention chunk table prefix"`
+	Table    time.Duration `flag:"table,0s,retention table duration"`
+	Chunks   time.Duration `flag:"chunks,0s,retention chunk duration"`
+	Tenants  string        `flag:"tenants,,retention chunk duration per tenant"`
+	Rate     int           `flag:"rate,100,retention deletes per second"`
+	Interval time.Duration `flag:"interval,10m,retention interval"`
+	DryRun   bool          `flag:"dryrun,,retention dry run"`
+}
+
+type QuotaConfig struct {
+	Bytes    int64         `flag:"bytes,0,quota stored bytes per tenant"`
+	Chunks   int64         `flag:"chunks,0,quota chunk count per tenant"`
+	Rate     int           `flag:"rate,0,quota write bytes per second per tenant"`
+	Tenants  string        `flag:"tenants,,quota limits file per tenant"`
+	Interval time.Duration `flag:"interval,1h,quota rescan interval"`
+	State    string        `flag:"state,quota.json,quota state object"`
 }
@@ -0,0 +1,39 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package types
+
+// ObjectDecorator is an ObjectClient wrapping others, it implements every capability
+// and forwards them to the wrapped clients.
+type ObjectDecorator interface {
+	ObjectClient
+	ObjectLister
+	ObjectStater
+}
+
+// Decorate returns outer exposing only the capabilities every inner client has,
+// so Lister and Stater keep reporting what the drivers really support.
+func Decorate(outer ObjectDecorator, inner ...ObjectClient) ObjectClient {
+	list, stat := true, true
+	for _, c := range inner {
+		_, l := c.(ObjectLister)
+		_, s := c.(ObjectStater)
+		list, stat = list && l, stat && s
+	}
+
+	switch {
+	case list && stat:
+		return outer
+	case list:
+		return struct {
+			ObjectClient
+			ObjectLister
+		}{outer, outer}
+	case stat:
+		return struct {
+			ObjectClient
+			ObjectStater
+		}{outer, outer}
+	}
+	return struct{ ObjectClient }{outer}
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package types
+
+import (
+	"context"
+	stderrors "errors"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"os"
+)
+
+type ErrorKind int
+
+const (
+	KindUnknown ErrorKind = iota
+	KindNotFound
+	KindPermissionDenied
+	KindThrottled
+	KindUnavailable
+	KindInvalidKey
+	KindTimeout
+	KindCorrupt
+	KindQuota
+)
+
+var __kind = []string{"unknown", "not found", "permission denied", "throttled", "unavailable", "invalid key", "timeout", "corrupt", "quota exceeded"}
+
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(__kind) {
+		return __kind[0]
+	}
+	return __kind[k]
+}
+
+var ErrNotFound = errors.New("object not found")
+
+// Error is the error returned by drivers once they classified the failure of their backend.
+type Error struct {
+	Kind ErrorKind
+	Key  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if "" == e.Key {
+		return e.Kind.String() + ": " + e.Err.Error()
+	}
+	return e.Kind.String() + " '" + e.Key + "': " + e.Err.Error()
+}
+
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError classifies err, errors of KindUnknown and nil are returned unchanged.
+func NewError(kind ErrorKind, key string, err error) error {
+	if nil == err || KindUnknown == kind {
+		return err
+	}
+	if e, ok := err.(*Error); ok && e.Kind == kind {
+		return e
+	}
+	return &Error{Kind: kind, Key: key, Err: err}
+}
+
+func NotFound(key string) error {
+	return &Error{Kind: KindNotFound, Key: key, Err: ErrNotFound}
+}
+
+func KindOf(err error) ErrorKind {
+	for nil != err {
+		if e, ok := err.(*Error); ok {
+			return e.Kind
+		}
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			if ErrNotFound == err {
+				return KindNotFound
+			}
+			return KindUnknown
+		}
+	}
+	return KindUnknown
+}
+
+func IsNotFound(err error) bool {
+	return KindNotFound == KindOf(err)
+}
+
+// IsRetryable reports failures which may succeed when the same call is made again.
+func IsRetryable(err error) bool {
+	switch KindOf(err) {
+	case KindThrottled, KindUnavailable, KindTimeout:
+		return true
+	}
+	return false
+}
+
+// KindOfStatus maps a http status code of an object storage to its kind.
+func KindOfStatus(code int) ErrorKind {
+	switch {
+	case http.StatusNotFound == code:
+		return KindNotFound
+	case http.StatusUnauthorized == code, http.StatusForbidden == code:
+		return KindPermissionDenied
+	case http.StatusTooManyRequests == code:
+		return KindThrottled
+	case http.StatusRequestTimeout == code, http.StatusGatewayTimeout == code:
+		return KindTimeout
+	case http.StatusRequestURITooLong == code:
+		return KindInvalidKey
+	case code >= http.StatusInternalServerError:
+		return KindUnavailable
+	}
+	return KindUnknown
+}
+
+// KindOfError classifies the errors shared by every driver, the context, network and os errors.
+func KindOfError(err error) ErrorKind {
+	if k := KindOf(err); KindUnknown != k {
+		return k
+	}
+
+	cause := errors.Cause(err)
+	if context.DeadlineExceeded == cause || os.IsTimeout(cause) {
+		return KindTimeout
+	}
+	if os.IsNotExist(cause) {
+		return KindNotFound
+	}
+	if os.IsPermission(cause) {
+		return KindPermissionDenied
+	}
+
+	var ne net.Error
+	if stderrors.As(cause, &ne) {
+		if ne.Timeout() {
+			return KindTimeout
+		}
+		return KindUnavailable
+	}
+
+	return KindUnknown
+}
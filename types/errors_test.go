@@ -0,0 +1,36 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package types
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestKindOfError(t *testing.T) {
+	cases := map[error]ErrorKind{
+		NotFound("fake"):                                     KindNotFound,
+		errors.Wrap(NotFound("fake"), "get"):                 KindNotFound,
+		NewError(KindThrottled, "fake", errors.New("slow")):  KindThrottled,
+		errors.Wrap(context.DeadlineExceeded, "get"):         KindTimeout,
+		&os.PathError{Op: "open", Err: os.ErrNotExist}:       KindNotFound,
+		&os.PathError{Op: "open", Err: os.ErrPermission}:     KindPermissionDenied,
+		&net.OpError{Op: "dial", Err: errors.New("refused")}: KindUnavailable,
+		errors.New("unknown"):                                KindUnknown,
+	}
+	for err, kind := range cases {
+		if k := KindOfError(err); k != kind {
+			t.Errorf("%v: got %s, want %s", err, k, kind)
+		}
+	}
+	if !IsRetryable(NewError(KindOfStatus(503), "fake", errors.New("http status 503"))) {
+		t.Error("retryable failed")
+	}
+	if IsRetryable(NewError(KindOfStatus(403), "fake", errors.New("http status 403"))) {
+		t.Error("permanent failed")
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package types
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/api"
+)
+
+type IndexClient interface {
+	WriteIndex(ctx context.Context, entries []*api.IndexEntry) error
+	QueryIndex(ctx context.Context, query *api.QueryIndexRequest, callback func([]*api.Row) error) error
+	DeleteIndex(ctx context.Context, entries []*api.IndexEntry) error
+	DeleteTable(ctx context.Context, name string) error
+	Close() error
+}
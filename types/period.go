@@ -0,0 +1,32 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package types
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeriodicTable names tables like loki, the prefix followed by the index of the period since epoch.
+type PeriodicTable struct {
+	Prefix string
+	Period time.Duration
+}
+
+func (p PeriodicTable) Name(t time.Time) string {
+	return p.Prefix + strconv.FormatInt(t.Unix()/int64(p.Period/time.Second), 10)
+}
+
+func (p PeriodicTable) Parse(name string) (from time.Time, through time.Time, ok bool) {
+	if p.Period < time.Second || !strings.HasPrefix(name, p.Prefix) {
+		return
+	}
+	n, err := strconv.ParseInt(name[len(p.Prefix):], 10, 64)
+	if nil != err || n < 0 {
+		return
+	}
+	seconds := int64(p.Period / time.Second)
+	return time.Unix(n*seconds, 0), time.Unix((n+1)*seconds, 0), true
+}
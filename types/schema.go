@@ -0,0 +1,11 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package types
+
+// KeySchema lays out the object keys of chunks, Decode reverses Encode
+// so listings can recover the chunk ids.
+type KeySchema interface {
+	Encode(info *CheckInfo) string
+	Decode(key string) (string, bool)
+}
@@ -0,0 +1,17 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package types
+
+import (
+	"context"
+	"github/vlorc/loki-grpc-storage/api"
+)
+
+type TableClient interface {
+	ListTables(ctx context.Context) ([]string, error)
+	CreateTable(ctx context.Context, desc *api.TableDesc) error
+	DeleteTable(ctx context.Context, name string) error
+	DescribeTable(ctx context.Context, name string) (*api.TableDesc, bool, error)
+	UpdateTable(ctx context.Context, current, expected *api.TableDesc) error
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package utils
+
+import (
+	"github.com/pkg/errors"
+	"net/url"
+	"strings"
+)
+
+// KeyEncoder maps object keys to the names a backend accepts, Decode is the exact inverse of Encode.
+// Both keep '/' and work byte by byte, so an encoded prefix is a prefix of the encoded keys.
+type KeyEncoder interface {
+	Encode(key string) string
+	Decode(key string) (string, error)
+}
+
+var (
+	// PathEncoder escapes every byte outside [A-Za-z0-9._~!*'()-] and the segments "." and "..",
+	// the characters loki allows in tenants are kept so the names written before stay the same.
+	PathEncoder KeyEncoder = newEscaper("-._~!*'()", true)
+	// ObjectEncoder escapes every byte outside the safe characters of object storages [A-Za-z0-9!-_.*'()].
+	ObjectEncoder KeyEncoder = newEscaper("!-_.*'()", false)
+	// URLEncoder escapes the segments of a http path.
+	URLEncoder KeyEncoder = pathEscaper{}
+)
+
+type escaper struct {
+	safe [256]bool
+	dots bool
+}
+
+func newEscaper(extra string, dots bool) *escaper {
+	e := &escaper{dots: dots}
+	for c := 0; c < 256; c++ {
+		e.safe[c] = 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+	}
+	for _, c := range []byte(extra) {
+		e.safe[c] = true
+	}
+	e.safe['/'] = true
+	return e
+}
+
+func (e *escaper) Encode(key string) string {
+	i := 0
+	for i < len(key) && e.safe[key[i]] {
+		i++
+	}
+	if i == len(key) && !(e.dots && e.dotted(key)) {
+		return key
+	}
+
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	b.Grow(len(key) + 8)
+	for _, seg := range strings.SplitAfter(key, "/") {
+		name := strings.TrimSuffix(seg, "/")
+		dots := e.dots && ("." == name || ".." == name)
+		for _, c := range []byte(seg) {
+			if e.safe[c] && !(dots && '.' == c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&15])
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func (e *escaper) dotted(key string) bool {
+	for _, seg := range strings.Split(key, "/") {
+		if "." == seg || ".." == seg {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *escaper) Decode(key string) (string, error) {
+	if strings.IndexByte(key, '%') < 0 {
+		return key, nil
+	}
+	b := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		if '%' != key[i] {
+			b = append(b, key[i])
+			continue
+		}
+		if i+2 >= len(key) {
+			return "", errors.Errorf("invalid escape in key '%s'", key)
+		}
+		h, ok1 := unhex(key[i+1])
+		l, ok2 := unhex(key[i+2])
+		if !ok1 || !ok2 {
+			return "", errors.Errorf("invalid escape in key '%s'", key)
+		}
+		b, i = append(b, h<<4|l), i+2
+	}
+	return string(b), nil
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+type pathEscaper struct{}
+
+func (pathEscaper) Encode(key string) string {
+	segs := strings.Split(key, "/")
+	for i := range segs {
+		segs[i] = url.PathEscape(segs[i])
+	}
+	return strings.Join(segs, "/")
+}
+
+func (pathEscaper) Decode(key string) (string, error) {
+	segs := strings.Split(key, "/")
+	for i := range segs {
+		s, err := url.PathUnescape(segs[i])
+		if nil != err {
+			return "", err
+		}
+		segs[i] = s
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// DecodeKey decodes a key listed from a backend, names which were not written through the encoder are kept.
+func DecodeKey(e KeyEncoder, key string) string {
+	if k, err := e.Decode(key); nil == err {
+		return k
+	}
+	return key
+}
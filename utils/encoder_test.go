@@ -0,0 +1,78 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+var __keys = []string{
+	__id2,
+	"index_2650/" + __id2,
+	"index/index_2650/0000002650/0001627000000000000000-node",
+	"fake/a b?c#d%e&f+g",
+	"fake/../a/./b",
+	"fake/c:\\d<e>f|g*h\"i",
+	"fake/\x00\x7f\xff",
+	"",
+}
+
+func TestKeyEncoder_RoundTrip(t *testing.T) {
+	encoders := map[string]KeyEncoder{"path": PathEncoder, "object": ObjectEncoder, "url": URLEncoder}
+	for name, e := range encoders {
+		seen := map[string]string{}
+		for _, k := range __keys {
+			enc := e.Encode(k)
+			if dec, err := e.Decode(enc); nil != err || dec != k {
+				t.Error("round trip failed", name, k, enc, dec, err)
+			}
+			if other, ok := seen[enc]; ok {
+				t.Error("collision", name, k, other)
+			}
+			seen[enc] = k
+		}
+		if e.Encode(__id2) != __id2 {
+			t.Error("legacy key changed", name, e.Encode(__id2))
+		}
+		if k := "t!*'()-_.x/" + __id2; "url" != name && e.Encode(k) != k {
+			t.Error("loki tenant changed", name, e.Encode(k))
+		}
+	}
+
+	if k := PathEncoder.Encode("fake/../a/./b"); strings.Contains(k, "/../") || strings.Contains(k, "/./") {
+		t.Error("path dots failed", k)
+	}
+	for _, c := range ":\\<>|\"?" {
+		if strings.ContainsRune(PathEncoder.Encode("fake/c:\\d<e>f|g*h\"i?"), c) {
+			t.Error("path escape failed", string(c))
+		}
+	}
+}
+
+func TestAppendKey_RoundTrip(t *testing.T) {
+	ids := []string{__id1, "fake/a_b:c", "fake/a:b_c", "fake/a%5Fb:c", "team_a/x:y", "team:a/x:y", "team%3Aa/x:y", "team%a/x:y"}
+	seen := map[string]string{}
+	for _, id := range ids {
+		k := FormatKey(id)
+		if p := ParseKey(k); p != id {
+			t.Error("round trip failed", id, k, p)
+		}
+		if other, ok := seen[k]; ok {
+			t.Error("collision", id, other)
+		}
+		seen[k] = id
+	}
+}
+
+func TestAppendKey_Legacy(t *testing.T) {
+	for _, id := range []string{__id1, "team_a/" + __id1[5:], "t!*'()/x:y"} {
+		if k := FormatKey(id); k != LegacyKey(id) {
+			t.Error("historical key changed", id, k)
+		}
+	}
+	if k := FormatKey("team:a/x:y"); k == FormatKey("team_a/x:y") || ParseKey(k) != "team:a/x:y" {
+		t.Error("tenant escape failed", k)
+	}
+}
@@ -6,6 +6,7 @@ package utils
 import (
 	"flag"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -59,16 +60,32 @@ func __flag(val reflect.Value, parent string) {
 			flag.IntVar(val.Field(i).Addr().Interface().(*int), name, v, usage)
 		case reflect.Bool:
 			flag.BoolVar(val.Field(i).Addr().Interface().(*bool), name, len(tags) >= 2 && "true" == tags[1], usage)
+		case reflect.Int64:
+			if p, ok := val.Field(i).Addr().Interface().(*time.Duration); ok {
+				var v time.Duration
+				if len(tags) >= 2 {
+					v, _ = time.ParseDuration(tags[1])
+				}
+				flag.DurationVar(p, name, v, usage)
+			} else if p, ok := val.Field(i).Addr().Interface().(*int64); ok {
+				var v int64
+				if len(tags) >= 2 {
+					v, _ = strconv.ParseInt(tags[1], 10, 64)
+				}
+				flag.Int64Var(p, name, v, usage)
+			}
 		}
 	}
 }
 
+// __value expands a placeholder leading the value, "{tmpdir}/index" is the index directory of the temporary directory.
 func __value(val string) string {
-	if len(val) < 3 || '{' != val[0] || '}' != val[len(val)-1] {
+	i := strings.IndexByte(val, '}')
+	if len(val) < 3 || '{' != val[0] || i < 0 {
 		return val
 	}
 
-	val = val[1 : len(val)-1]
+	val, rest := val[1:i], val[i+1:]
 	switch val {
 	case "hostname":
 		val, _ = os.Hostname()
@@ -79,6 +96,9 @@ func __value(val string) string {
 	case "timestamp":
 		val = strconv.FormatInt(time.Now().Unix(), 10)
 	}
+	if "" != rest {
+		val = filepath.Join(val, filepath.FromSlash(rest))
+	}
 
 	return val
 }
@@ -13,8 +13,16 @@ func FormatKey(k string) string {
 	return AppendKey(k, nil)
 }
 
+// AppendKey writes the chunk id k as an object key, ':' becomes '_' and the '_' and '%' already
+// in the id, as well as the ':' and '%' of the tenant, are escaped so ParseKey is an exact inverse.
+// The ids and tenants without them, which are all the ones loki writes, keep their historical key.
 func AppendKey(k string, b []byte) string {
-	i := strings.IndexByte(k, ':')
+	i := strings.LastIndexByte(k, '/') + 1
+	if strings.IndexAny(k[:i], ":%") >= 0 || strings.IndexAny(k[i:], "_%") >= 0 {
+		return escapeKey(k)
+	}
+
+	i = strings.IndexByte(k, ':')
 	if i < 0 {
 		return k
 	}
@@ -33,3 +41,82 @@ func AppendKey(k string, b []byte) string {
 
 	return s
 }
+
+// LegacyKey is the key the chunk id k was written under before the ids and tenants were escaped,
+// it differs from FormatKey only for the ids and tenants ParseKey could not recover.
+func LegacyKey(k string) string {
+	return strings.ReplaceAll(k, ":", "_")
+}
+
+func escapeKey(k string) string {
+	i := strings.LastIndexByte(k, '/') + 1
+
+	var b strings.Builder
+	b.Grow(len(k) + 8)
+	b.WriteString(EscapeTenant(k[:i]))
+	for _, c := range []byte(k[i:]) {
+		switch c {
+		case '%':
+			b.WriteString("%25")
+		case '_':
+			b.WriteString("%5F")
+		case ':':
+			b.WriteByte('_')
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// EscapeTenant escapes the ':' and '%' of a tenant, the other bytes are kept.
+func EscapeTenant(s string) string {
+	if strings.IndexAny(s, ":%") < 0 {
+		return s
+	}
+	return strings.NewReplacer("%", "%25", ":", "%3A").Replace(s)
+}
+
+// UnescapeTenant reverses EscapeTenant.
+func UnescapeTenant(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return s
+	}
+	return strings.NewReplacer("%25", "%", "%3A", ":").Replace(s)
+}
+
+// UnescapeKey reverses AppendKey on the last segment of an object key.
+func UnescapeKey(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return strings.ReplaceAll(s, "_", ":")
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch {
+		case '_' == s[i]:
+			b = append(b, ':')
+		case strings.HasPrefix(s[i:], "%25"):
+			b, i = append(b, '%'), i+2
+		case strings.HasPrefix(s[i:], "%5F"):
+			b, i = append(b, '_'), i+2
+		default:
+			b = append(b, s[i])
+		}
+	}
+
+	return string(b)
+}
+
+// ParseKey recovers the chunk ID from an object key written by AppendKey,
+// dropping any prefix in front of the tenant.
+func ParseKey(key string) string {
+	i := strings.LastIndexByte(key, '/')
+	if i < 0 {
+		return key
+	}
+	j := strings.LastIndexByte(key[:i], '/')
+
+	return UnescapeTenant(key[j+1:i+1]) + UnescapeKey(key[i+1:])
+}
@@ -54,3 +54,11 @@ func BenchmarkUnsafeBytesReplace(b *testing.B) {
 		}
 	}
 }
+
+func TestParseKey(t *testing.T) {
+	for _, k := range []string{__id2, "index_2650/" + __id2} {
+		if id := ParseKey(k); id != __id1 {
+			t.Error("parse failed", k, id)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package utils
+
+import "context"
+
+type storedKey struct{}
+
+// WithStored asks the decorators changing the objects put with the context to report the bytes stored in n.
+func WithStored(ctx context.Context, n *int64) context.Context {
+	return context.WithValue(ctx, storedKey{}, n)
+}
+
+// Stored reports the bytes of the object passed down to the store, decorators call it before
+// the put of the store below so the innermost one is kept.
+func Stored(ctx context.Context, n int) {
+	if p, ok := ctx.Value(storedKey{}).(*int64); ok {
+		*p = int64(n)
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2021 vlorc. All rights reserved.
+// Use of this source code is governed by an Apache 2.0 license that can be found in the LICENSE file at the root of this project.
+
+package utils
+
+import "context"
+
+type tableKey struct{}
+
+// Table returns the table name the object of the call belongs to, if the caller knows it.
+func Table(ctx context.Context) string {
+	name, _ := ctx.Value(tableKey{}).(string)
+	return name
+}
+
+func WithTable(ctx context.Context, name string) context.Context {
+	if "" == name {
+		return ctx
+	}
+	return context.WithValue(ctx, tableKey{}, name)
+}